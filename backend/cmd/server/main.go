@@ -1,25 +1,43 @@
 package main
 
 import (
+	"context"
 	"log"
 
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/apitokens"
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/builds"
 	"go-mdbook/internal/config"
 	"go-mdbook/internal/db"
 	"go-mdbook/internal/handlers"
 	"go-mdbook/internal/middleware"
+	"go-mdbook/internal/poller"
+	"go-mdbook/internal/sessions"
+	"go-mdbook/internal/settings"
+	"go-mdbook/internal/sources"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	keys, err := auth.LoadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("jwt keys: %v", err)
+	}
 
 	client, err := db.Connect(cfg)
 	if err != nil {
 		log.Fatalf("db connect: %v", err)
 	}
 	defer func() {
-		_ = client.Disconnect(cfg.Context())
+		ctx, cancel := cfg.Context()
+		defer cancel()
+		_ = client.Disconnect(ctx)
 	}()
 
 	if err := db.EnsureIndexes(cfg, client); err != nil {
@@ -29,38 +47,119 @@ func main() {
 		log.Fatalf("ensure admin: %v", err)
 	}
 
+	store := sources.NewStore(cfg, client)
+	queue := builds.NewQueue(cfg, client, store)
+	if err := queue.Start(context.Background()); err != nil {
+		log.Fatalf("start build queue: %v", err)
+	}
+	poller.New(cfg, client, queue).Start(context.Background())
+
 	r := gin.Default()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("trusted proxies: %v", err)
+	}
 	r.Use(middleware.CORS())
 
-	h := handlers.New(cfg, client)
+	sess := sessions.NewStore(cfg, client)
+	tokens := apitokens.NewStore(cfg, client)
+	siteSettings := settings.NewStore(cfg, client)
+	resolver := access.NewResolver(cfg, client, siteSettings)
+	h := handlers.New(cfg, client, queue, store, sess, tokens, resolver, siteSettings, keys)
+
+	r.GET("/.well-known/jwks.json", h.JWKS)
 
 	api := r.Group("/api")
 	{
 		api.POST("/auth/login", h.Login)
+		api.POST("/auth/refresh", h.Refresh)
+		api.POST("/auth/logout", h.Logout)
+		api.POST("/auth/reset", h.RedeemReset)
+		api.POST("/auth/accept-invite", h.AcceptInvite)
+		api.POST("/auth/2fa", h.CompleteTwoFactor)
+		api.GET("/auth/oidc/login", h.OIDCLogin)
+		api.GET("/auth/oidc/callback", h.OIDCCallback)
+		api.GET("/content/:token/*filepath", h.SignedContent)
+		api.POST("/hooks/push/:bookId", h.PushHook)
+	}
+
+	perm := middleware.RequirePermission
+	bookPerm := func(p string) gin.HandlerFunc {
+		return middleware.RequireBookPermission(p, resolver)
 	}
 
 	protected := api.Group("")
-	protected.Use(middleware.Auth(cfg))
+	protected.Use(middleware.Auth(keys, sess, tokens, resolver))
 	{
 		protected.GET("/me", h.Me)
+		protected.POST("/me/password", middleware.RequireSession(), h.ChangePassword)
+		protected.POST("/me/2fa/enroll", middleware.RequireSession(), h.EnrollTwoFactor)
+		protected.POST("/me/2fa/verify", middleware.RequireSession(), h.VerifyTwoFactor)
+		protected.POST("/me/2fa/disable", middleware.RequireSession(), h.DisableTwoFactor)
+		protected.POST("/me/2fa/recovery-codes", middleware.RequireSession(), h.RegenerateRecoveryCodes)
+		protected.GET("/me/tokens", middleware.RequireSession(), h.ListMyTokens)
+		protected.POST("/me/tokens", middleware.RequireSession(), h.CreateToken)
+		protected.DELETE("/me/tokens/:tokenId", middleware.RequireSession(), h.RevokeMyToken)
 		protected.GET("/books", h.ListBooks)
 		protected.GET("/books/:id", h.GetBook)
 		protected.GET("/books/:id/content/*filepath", h.BookContent)
+		protected.POST("/books/:id/content-url", h.ContentURL)
+		protected.GET("/books/:id/builds/:buildId/content/*filepath", bookPerm(access.PermBooksBuild), h.PreviewBuildContent)
 	}
 
 	admin := api.Group("/admin")
-	admin.Use(middleware.Auth(cfg), middleware.RequireRole("admin"))
+	admin.Use(middleware.Auth(keys, sess, tokens, resolver))
 	{
-		admin.GET("/users", h.ListUsers)
-		admin.POST("/users", h.CreateUser)
-		admin.PATCH("/users/:id", h.UpdateUser)
-		admin.DELETE("/users/:id", h.DeleteUser)
-
-		admin.POST("/books", h.CreateBook)
-		admin.PATCH("/books/:id", h.UpdateBook)
-		admin.DELETE("/books/:id", h.DeleteBook)
-		admin.POST("/books/:id/upload", h.UploadBook)
-		admin.POST("/books/:id/build", h.BuildBook)
+		admin.GET("/users", perm(access.PermUsersManage), h.ListUsers)
+		admin.POST("/users", perm(access.PermUsersManage), h.CreateUser)
+		admin.PATCH("/users/:id", perm(access.PermUsersManage), h.UpdateUser)
+		admin.POST("/users/:id/reset-password", perm(access.PermUsersManage), h.ResetPassword)
+		admin.POST("/users/:id/unlock", perm(access.PermUsersManage), h.UnlockUser)
+		admin.POST("/users/:id/oidc-link", perm(access.PermUsersManage), h.AllowOIDCLink)
+		admin.DELETE("/users/:id/oidc-link", perm(access.PermUsersManage), h.UnlinkOIDC)
+		admin.DELETE("/users/:id", perm(access.PermUsersManage), h.DeleteUser)
+
+		admin.GET("/invites", perm(access.PermUsersManage), h.ListInvites)
+		admin.POST("/invites", perm(access.PermUsersManage), h.CreateInvite)
+		admin.DELETE("/invites/:inviteId", perm(access.PermUsersManage), h.RevokeInvite)
+
+		admin.GET("/settings", perm(access.PermUsersManage), h.GetSettings)
+		admin.PATCH("/settings", perm(access.PermUsersManage), h.UpdateSettings)
+
+		admin.GET("/tokens", perm(access.PermUsersManage), h.ListTokens)
+		admin.DELETE("/tokens/:tokenId", perm(access.PermUsersManage), h.RevokeToken)
+
+		admin.GET("/audit", perm(access.PermAuditRead), h.ListAudit)
+		admin.GET("/audit/export", perm(access.PermAuditRead), h.ExportAudit)
+
+		admin.GET("/groups", perm(access.PermGroupsManage), h.ListGroups)
+		admin.POST("/groups", perm(access.PermGroupsManage), h.CreateGroup)
+		admin.GET("/groups/:groupId", perm(access.PermGroupsManage), h.GetGroup)
+		admin.PATCH("/groups/:groupId", perm(access.PermGroupsManage), h.UpdateGroup)
+		admin.DELETE("/groups/:groupId", perm(access.PermGroupsManage), h.DeleteGroup)
+		admin.POST("/groups/:groupId/members", perm(access.PermGroupsManage), h.AddGroupMember)
+		admin.DELETE("/groups/:groupId/members/:userId", perm(access.PermGroupsManage), h.RemoveGroupMember)
+
+		admin.POST("/books", perm(access.PermBooksCreate), h.CreateBook)
+		admin.PATCH("/books/:id", bookPerm(access.PermBooksUpdate), h.UpdateBook)
+		admin.DELETE("/books/:id", perm(access.PermBooksDelete), h.DeleteBook)
+		admin.POST("/books/:id/upload", bookPerm(access.PermBooksUpload), h.UploadBook)
+		admin.GET("/books/:id/grants", perm(access.PermBooksGrants), h.ListGrants)
+		admin.PUT("/books/:id/grants", perm(access.PermBooksGrants), h.ReplaceGrants)
+		admin.POST("/books/:id/grants", perm(access.PermBooksGrants), h.AddGrant)
+		admin.DELETE("/books/:id/grants/:subject/:subjectId", perm(access.PermBooksGrants), h.RemoveGrant)
+		admin.GET("/books/:id/revisions", bookPerm(access.PermBooksUpload), h.ListRevisions)
+		admin.POST("/books/:id/revisions/:rev/activate", bookPerm(access.PermBooksUpload), h.ActivateRevision)
+		admin.POST("/books/:id/sync", bookPerm(access.PermBooksUpload), h.SyncBook)
+		admin.POST("/books/:id/webhook", bookPerm(access.PermBooksUpdate), h.RotateWebhook)
+		admin.DELETE("/books/:id/webhook", bookPerm(access.PermBooksUpdate), h.DisableWebhook)
+		admin.POST("/books/:id/build", bookPerm(access.PermBooksBuild), h.BuildBook)
+		admin.GET("/books/:id/builds", bookPerm(access.PermBooksBuild), h.ListBuilds)
+		admin.POST("/books/:id/publish", bookPerm(access.PermBooksPublish), h.PublishBook)
+		admin.DELETE("/books/:id/publish", bookPerm(access.PermBooksPublish), h.UnpublishBook)
+		admin.GET("/builds/:buildId", bookPerm(access.PermBooksBuild), h.GetBuild)
+		admin.POST("/builds/:buildId/cancel", bookPerm(access.PermBooksBuild), h.CancelBuild)
+		admin.GET("/builds/:buildId/logs", bookPerm(access.PermBooksBuild), h.BuildLogs)
+		admin.GET("/builds/:buildId/logs/stream", bookPerm(access.PermBooksBuild), h.StreamBuildLogs)
 	}
 
 	log.Printf("listening on %s", cfg.APIAddr)
@@ -0,0 +1,98 @@
+package access
+
+import (
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subject is the caller an access decision is made for. Role is the
+// effective role, already raised by the caller's group memberships.
+type Subject struct {
+	UserID primitive.ObjectID
+	Role   string
+	Groups []primitive.ObjectID
+
+	// Scopes limits a caller authenticated with an API token to these
+	// permissions; nil means no limit beyond the role.
+	Scopes []string
+
+	// NeedsTwoFactor is set for admins held back to a lesser Role until
+	// they enroll in two-factor authentication, as the settings require.
+	NeedsTwoFactor bool
+}
+
+func (s Subject) inGroup(id primitive.ObjectID) bool {
+	for _, g := range s.Groups {
+		if g == id {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRole is the most privileged of a user's own role and the roles
+// of the groups they belong to.
+func EffectiveRole(role string, groups []models.Group) string {
+	for _, g := range groups {
+		if roleRank[g.Role] > roleRank[role] {
+			role = g.Role
+		}
+	}
+	return role
+}
+
+var levelRank = map[string]int{
+	models.GrantRead:     1,
+	models.GrantMaintain: 2,
+}
+
+func ValidLevel(level string) bool {
+	return levelRank[level] > 0
+}
+
+// Level returns the highest level the subject is granted on book, directly
+// or through a group, or "" when it has no grant.
+func Level(book models.Book, s Subject) string {
+	best := ""
+	for _, g := range book.Grants {
+		matches := (g.Subject == models.GrantSubjectUser && g.ID == s.UserID) ||
+			(g.Subject == models.GrantSubjectGroup && s.inGroup(g.ID))
+		if matches && levelRank[g.Level] > levelRank[best] {
+			best = g.Level
+		}
+	}
+	return best
+}
+
+// CanRead reports whether the subject may see book and its content.
+func CanRead(book models.Book, s Subject) bool {
+	if s.Can(PermBooksReadAll) {
+		return true
+	}
+	if !book.Active {
+		return false
+	}
+	return !book.Restricted || Level(book, s) != ""
+}
+
+// ReadFilter narrows a query for active books to the ones the subject
+// may read.
+func ReadFilter(s Subject) bson.M {
+	if s.Can(PermBooksReadAll) {
+		return bson.M{"active": true}
+	}
+	groups := s.Groups
+	if groups == nil {
+		groups = []primitive.ObjectID{}
+	}
+	return bson.M{
+		"active": true,
+		"$or": bson.A{
+			bson.M{"restricted": bson.M{"$ne": true}},
+			bson.M{"grants": bson.M{"$elemMatch": bson.M{"subject": models.GrantSubjectUser, "id": s.UserID}}},
+			bson.M{"grants": bson.M{"$elemMatch": bson.M{"subject": models.GrantSubjectGroup, "id": bson.M{"$in": groups}}}},
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package access
+
+import (
+	"testing"
+
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCanRead(t *testing.T) {
+	reader := Subject{UserID: primitive.NewObjectID(), Role: "reader"}
+	granted := Subject{UserID: primitive.NewObjectID(), Role: "reader"}
+	admin := Subject{UserID: primitive.NewObjectID(), Role: "admin"}
+
+	open := models.Book{Active: true}
+	restricted := models.Book{Active: true, Restricted: true, Grants: []models.Grant{
+		{Subject: models.GrantSubjectUser, ID: granted.UserID, Level: models.GrantRead},
+	}}
+	inactive := models.Book{Active: false}
+
+	cases := []struct {
+		name    string
+		book    models.Book
+		subject Subject
+		want    bool
+	}{
+		{"open book", open, reader, true},
+		{"restricted without grant", restricted, reader, false},
+		{"restricted with grant", restricted, granted, true},
+		{"restricted as admin", restricted, admin, true},
+		{"inactive as reader", inactive, reader, false},
+		{"inactive as admin", inactive, admin, true},
+	}
+	for _, tc := range cases {
+		if got := CanRead(tc.book, tc.subject); got != tc.want {
+			t.Fatalf("%s: CanRead = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLevelPicksHighestGrant(t *testing.T) {
+	user := Subject{UserID: primitive.NewObjectID()}
+	book := models.Book{Grants: []models.Grant{
+		{Subject: models.GrantSubjectUser, ID: user.UserID, Level: models.GrantRead},
+		{Subject: models.GrantSubjectUser, ID: user.UserID, Level: models.GrantMaintain},
+	}}
+	if got := Level(book, user); got != models.GrantMaintain {
+		t.Fatalf("Level = %q, want %q", got, models.GrantMaintain)
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	group := models.Group{ID: primitive.NewObjectID(), Role: "admin"}
+	if got := EffectiveRole("editor", []models.Group{group}); got != "admin" {
+		t.Fatalf("EffectiveRole = %q, want admin", got)
+	}
+	if got := EffectiveRole("admin", []models.Group{{Role: "reader"}}); got != "admin" {
+		t.Fatalf("group role must not lower the user's own role, got %q", got)
+	}
+
+	member := Subject{UserID: primitive.NewObjectID(), Role: "reader", Groups: []primitive.ObjectID{group.ID}}
+	book := models.Book{Active: true, Restricted: true, Grants: []models.Grant{
+		{Subject: models.GrantSubjectGroup, ID: group.ID, Level: models.GrantRead},
+	}}
+	if !CanRead(book, member) {
+		t.Fatalf("expected group grant to allow reading")
+	}
+	if CanRead(book, Subject{UserID: primitive.NewObjectID(), Role: "reader"}) {
+		t.Fatalf("expected non-member to be denied")
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	admin := Subject{Role: RoleAdmin}
+	editor := Subject{Role: RoleEditor}
+	reader := Subject{UserID: primitive.NewObjectID(), Role: RoleReader}
+	unknown := Subject{Role: "superuser"}
+
+	if !admin.Can(PermUsersManage) || editor.Can(PermUsersManage) || reader.Can(PermBooksBuild) {
+		t.Fatalf("unexpected global permissions")
+	}
+	if !editor.Can(PermBooksBuild) || editor.Can(PermBooksDelete) {
+		t.Fatalf("unexpected editor permissions")
+	}
+	if unknown.Can(PermBooksReadAll) || ValidRole("superuser") {
+		t.Fatalf("unknown roles must grant nothing")
+	}
+
+	book := models.Book{Grants: []models.Grant{
+		{Subject: models.GrantSubjectUser, ID: reader.UserID, Level: models.GrantMaintain},
+	}}
+	if !reader.CanOnBook(book, PermBooksUpload) || !reader.CanOnBook(book, PermBooksBuild) {
+		t.Fatalf("expected maintainer to upload and build")
+	}
+	if reader.CanOnBook(book, PermBooksDelete) || reader.CanOnBook(book, PermBooksGrants) {
+		t.Fatalf("maintainer must not delete the book or change its grants")
+	}
+	if reader.CanOnBook(models.Book{}, PermBooksBuild) {
+		t.Fatalf("maintainer grant must not apply to other books")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	admin := Subject{Role: RoleAdmin, Scopes: []string{PermBooksUpload, PermBooksBuild}}
+	if !admin.Can(PermBooksBuild) || admin.Can(PermUsersManage) || admin.Can(PermBooksReadAll) {
+		t.Fatalf("scopes must narrow the role's permissions")
+	}
+
+	reader := Subject{UserID: primitive.NewObjectID(), Role: RoleReader, Scopes: []string{PermBooksUpload, PermUsersManage}}
+	if reader.Can(PermUsersManage) {
+		t.Fatalf("scopes must not add permissions the role lacks")
+	}
+	book := models.Book{Grants: []models.Grant{
+		{Subject: models.GrantSubjectUser, ID: reader.UserID, Level: models.GrantMaintain},
+	}}
+	if !reader.CanOnBook(book, PermBooksUpload) || reader.CanOnBook(book, PermBooksBuild) {
+		t.Fatalf("scopes must narrow maintainer permissions")
+	}
+
+	noScopes := Subject{Role: RoleAdmin, Scopes: []string{}}
+	if noScopes.Can(PermBooksBuild) {
+		t.Fatalf("an empty scope list must allow nothing")
+	}
+}
+
+func TestWithoutAdmin(t *testing.T) {
+	editors := models.Group{Role: RoleEditor}
+	admins := models.Group{Role: RoleAdmin}
+	cases := []struct {
+		role   string
+		groups []models.Group
+		want   string
+	}{
+		{RoleAdmin, nil, RoleReader},
+		{RoleAdmin, []models.Group{editors}, RoleEditor},
+		{RoleEditor, []models.Group{admins}, RoleEditor},
+		{RoleReader, []models.Group{admins}, RoleReader},
+	}
+	for _, tc := range cases {
+		if got := withoutAdmin(tc.role, tc.groups); got != tc.want {
+			t.Errorf("withoutAdmin(%q, %v) = %q, want %q", tc.role, tc.groups, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package access
+
+import "go-mdbook/internal/models"
+
+const (
+	// PermBooksReadAll lets a subject see every book, including inactive
+	// and restricted ones, regardless of grants.
+	PermBooksReadAll = "books:read_all"
+	PermBooksCreate  = "books:create"
+	PermBooksUpdate  = "books:update"
+	PermBooksDelete  = "books:delete"
+	PermBooksUpload  = "books:upload"
+	PermBooksBuild   = "books:build"
+	PermBooksPublish = "books:publish"
+	PermBooksGrants  = "books:grants"
+	PermUsersManage  = "users:manage"
+	PermGroupsManage = "groups:manage"
+	PermAuditRead    = "audit:read"
+	// PermGitCredentials lets a subject pick which server credentials a
+	// book's Git source uses.
+	PermGitCredentials = "git:credentials"
+)
+
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var AllPermissions = []string{
+	PermBooksReadAll,
+	PermBooksCreate,
+	PermBooksUpdate,
+	PermBooksDelete,
+	PermBooksUpload,
+	PermBooksBuild,
+	PermBooksPublish,
+	PermBooksGrants,
+	PermUsersManage,
+	PermGroupsManage,
+	PermAuditRead,
+	PermGitCredentials,
+}
+
+var rolePermissions = map[string][]string{
+	RoleReader: {},
+	RoleEditor: {
+		PermBooksReadAll,
+		PermBooksCreate,
+		PermBooksUpdate,
+		PermBooksUpload,
+		PermBooksBuild,
+		PermBooksPublish,
+	},
+	RoleAdmin: AllPermissions,
+}
+
+// maintainerPermissions are what a "maintain" grant allows on that one
+// book.
+var maintainerPermissions = []string{
+	PermBooksUpdate,
+	PermBooksUpload,
+	PermBooksBuild,
+	PermBooksPublish,
+}
+
+// roleRank orders roles so the most privileged of several can be picked.
+var roleRank = map[string]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// HighestRole returns the most privileged of roles, or "" if none of them
+// is known.
+func HighestRole(roles ...string) string {
+	best := ""
+	for _, role := range roles {
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Permissions lists what a role may do globally.
+func Permissions(role string) []string {
+	return append([]string{}, rolePermissions[role]...)
+}
+
+func ValidPermission(perm string) bool {
+	return contains(AllPermissions, perm)
+}
+
+// Can reports whether the subject's role grants perm everywhere.
+func (s Subject) Can(perm string) bool {
+	return contains(rolePermissions[s.Role], perm) && s.scoped(perm)
+}
+
+// CanOnBook reports whether the subject may perform perm on book, either
+// through its role or as a maintainer of the book.
+func (s Subject) CanOnBook(book models.Book, perm string) bool {
+	if s.Can(perm) {
+		return true
+	}
+	return Level(book, s) == models.GrantMaintain && contains(maintainerPermissions, perm) && s.scoped(perm)
+}
+
+func (s Subject) scoped(perm string) bool {
+	return s.Scopes == nil || contains(s.Scopes, perm)
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
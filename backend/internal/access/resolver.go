@@ -0,0 +1,121 @@
+package access
+
+import (
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+	"go-mdbook/internal/settings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Resolver looks up a user's group memberships to build their Subject.
+// It runs on every authenticated request, so group and role changes take
+// effect immediately.
+type Resolver struct {
+	cfg      config.Config
+	client   *mongo.Client
+	settings *settings.Store
+}
+
+func NewResolver(cfg config.Config, client *mongo.Client, store *settings.Store) *Resolver {
+	return &Resolver{cfg: cfg, client: client, settings: store}
+}
+
+func (r *Resolver) Resolve(userID primitive.ObjectID, role string) (Subject, error) {
+	ctx, cancel := r.cfg.Context()
+	defer cancel()
+	cur, err := r.client.Database(r.cfg.MongoDB).Collection("groups").Find(ctx, bson.M{"member_ids": userID})
+	if err != nil {
+		return Subject{}, err
+	}
+	defer cur.Close(ctx)
+	groups := []models.Group{}
+	if err := cur.All(ctx, &groups); err != nil {
+		return Subject{}, err
+	}
+
+	subject := Subject{UserID: userID, Role: EffectiveRole(role, groups)}
+	for _, g := range groups {
+		subject.Groups = append(subject.Groups, g.ID)
+	}
+	if subject.Role == RoleAdmin {
+		missing, err := r.twoFactorMissing(userID)
+		if err != nil {
+			return Subject{}, err
+		}
+		if missing {
+			subject.Role = withoutAdmin(role, groups)
+			subject.NeedsTwoFactor = true
+		}
+	}
+	return subject, nil
+}
+
+// twoFactorMissing reports whether two-factor authentication is required
+// for admins and the user has not enabled it.
+func (r *Resolver) twoFactorMissing(userID primitive.ObjectID) (bool, error) {
+	ctx, cancel := r.cfg.Context()
+	defer cancel()
+	current, err := r.settings.Get()
+	if err != nil || !current.RequireAdmin2FA {
+		return false, err
+	}
+	count, err := r.client.Database(r.cfg.MongoDB).Collection("users").CountDocuments(ctx, bson.M{"_id": userID, "totp_enabled": true})
+	return count == 0, err
+}
+
+// withoutAdmin is the effective role ignoring every admin role, for admins
+// who must enroll in two-factor authentication first.
+func withoutAdmin(role string, groups []models.Group) string {
+	roles := []string{RoleReader}
+	if role != RoleAdmin {
+		roles = append(roles, role)
+	}
+	for _, g := range groups {
+		if g.Role != RoleAdmin {
+			roles = append(roles, g.Role)
+		}
+	}
+	return HighestRole(roles...)
+}
+
+// ResolveUser builds the Subject of an active user from the stored
+// account, for callers that do not carry a role claim.
+func (r *Resolver) ResolveUser(userID primitive.ObjectID) (Subject, error) {
+	ctx, cancel := r.cfg.Context()
+	defer cancel()
+	var user models.User
+	err := r.client.Database(r.cfg.MongoDB).Collection("users").FindOne(ctx, bson.M{"_id": userID, "active": true}).Decode(&user)
+	if err != nil {
+		return Subject{}, err
+	}
+	return r.Resolve(user.ID, user.Role)
+}
+
+// Book loads the book a request targets, named either directly by bookID
+// or through one of its builds when bookID is empty.
+func (r *Resolver) Book(bookID, buildID string) (models.Book, error) {
+	ctx, cancel := r.cfg.Context()
+	defer cancel()
+	db := r.client.Database(r.cfg.MongoDB)
+	if bookID == "" {
+		id, err := primitive.ObjectIDFromHex(buildID)
+		if err != nil {
+			return models.Book{}, err
+		}
+		var build models.Build
+		if err := db.Collection("builds").FindOne(ctx, bson.M{"_id": id}).Decode(&build); err != nil {
+			return models.Book{}, err
+		}
+		bookID = build.BookID.Hex()
+	}
+	id, err := primitive.ObjectIDFromHex(bookID)
+	if err != nil {
+		return models.Book{}, err
+	}
+	var book models.Book
+	err = db.Collection("books").FindOne(ctx, bson.M{"_id": id}).Decode(&book)
+	return book, err
+}
@@ -0,0 +1,185 @@
+package apitokens
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Prefix marks API tokens so they can be told apart from access tokens
+// and spotted by secret scanners.
+const Prefix = "mdb_"
+
+var (
+	ErrInvalidToken  = errors.New("invalid api token")
+	ErrTokenNotFound = errors.New("api token not found")
+)
+
+// Store persists API tokens. A token is "mdb_<id>_<secret>"; the id finds
+// the record and the secret is checked against its hash.
+type Store struct {
+	cfg    config.Config
+	client *mongo.Client
+}
+
+func NewStore(cfg config.Config, client *mongo.Client) *Store {
+	return &Store{cfg: cfg, client: client}
+}
+
+func (s *Store) tokens() *mongo.Collection {
+	return s.client.Database(s.cfg.MongoDB).Collection("api_tokens")
+}
+
+func IsToken(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Create mints a token for userID and returns it with its secret, which
+// is not stored and cannot be shown again.
+func (s *Store) Create(userID primitive.ObjectID, name string, scopes []string, expiresAt *time.Time) (models.APIToken, string, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	secret, err := auth.RandomToken(32)
+	if err != nil {
+		return models.APIToken{}, "", err
+	}
+	token := models.APIToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		TokenHash: auth.HashToken(secret),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if _, err := s.tokens().InsertOne(ctx, token); err != nil {
+		return models.APIToken{}, "", err
+	}
+	return token, format(token.ID, secret), nil
+}
+
+// Authenticate returns the live token a secret belongs to and records
+// that it was used.
+func (s *Store) Authenticate(raw string) (models.APIToken, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	id, secret, ok := parse(raw)
+	if !ok {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	var token models.APIToken
+	if err := s.tokens().FindOne(ctx, bson.M{"_id": id, "revoked_at": nil}).Decode(&token); err != nil {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(token.TokenHash)) != 1 {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	if _, err := s.tokens().UpdateByID(ctx, token.ID, bson.M{"$set": bson.M{"last_used_at": now}}); err != nil {
+		return models.APIToken{}, err
+	}
+	token.LastUsedAt = &now
+	return token, nil
+}
+
+// Lookup returns a live token by its ID, for links minted while using it.
+func (s *Store) Lookup(tokenID string) (models.APIToken, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	var token models.APIToken
+	if err := s.tokens().FindOne(ctx, bson.M{"_id": id, "revoked_at": nil}).Decode(&token); err != nil {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// List returns tokens newest first, limited to one user unless userID is
+// nil.
+func (s *Store) List(userID *primitive.ObjectID) ([]models.APIToken, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	filter := bson.M{}
+	if userID != nil {
+		filter["user_id"] = *userID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cur, err := s.tokens().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	list := []models.APIToken{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Revoke ends a token. With a non-nil userID it only matches that user's
+// tokens.
+func (s *Store) Revoke(id primitive.ObjectID, userID *primitive.ObjectID) error {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	filter := bson.M{"_id": id}
+	if userID != nil {
+		filter["user_id"] = *userID
+	}
+	var token models.APIToken
+	if err := s.tokens().FindOne(ctx, filter).Decode(&token); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrTokenNotFound
+		}
+		return err
+	}
+	_, err := s.tokens().UpdateOne(ctx,
+		bson.M{"_id": id, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+func (s *Store) RevokeUser(userID primitive.ObjectID) error {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	_, err := s.tokens().UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+func format(id primitive.ObjectID, secret string) string {
+	return Prefix + id.Hex() + "_" + secret
+}
+
+func parse(token string) (primitive.ObjectID, string, bool) {
+	rest, ok := strings.CutPrefix(token, Prefix)
+	if !ok || len(rest) < 26 || rest[24] != '_' {
+		return primitive.ObjectID{}, "", false
+	}
+	id, err := primitive.ObjectIDFromHex(rest[:24])
+	if err != nil {
+		return primitive.ObjectID{}, "", false
+	}
+	return id, rest[25:], true
+}
@@ -0,0 +1,33 @@
+package apitokens
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFormatParse(t *testing.T) {
+	id := primitive.NewObjectID()
+	token := format(id, "se_cr-et")
+	if !IsToken(token) {
+		t.Fatalf("%q not recognised as an api token", token)
+	}
+	gotID, secret, ok := parse(token)
+	if !ok || gotID != id || secret != "se_cr-et" {
+		t.Fatalf("parse(%q) = %v, %q, %v", token, gotID, secret, ok)
+	}
+
+	for _, bad := range []string{
+		"",
+		"mdb_",
+		"mdb_" + id.Hex(),
+		"mdb_" + id.Hex() + "_",
+		"mdb_" + id.Hex() + "x",
+		"mdb_zzzzzzzzzzzzzzzzzzzzzzzz_secret",
+		"eyJhbGciOiJIUzI1NiJ9.e30.sig",
+	} {
+		if _, _, ok := parse(bad); ok {
+			t.Errorf("parse(%q) accepted a malformed token", bad)
+		}
+	}
+}
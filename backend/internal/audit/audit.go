@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"log"
+	"time"
+
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Logger appends events to the audit_events collection. Failing to record
+// an event is logged but never fails the action that caused it.
+type Logger struct {
+	cfg    config.Config
+	client *mongo.Client
+}
+
+func NewLogger(cfg config.Config, client *mongo.Client) *Logger {
+	return &Logger{cfg: cfg, client: client}
+}
+
+// events decodes nested values of changes and details as plain maps, so
+// they serialize back to the JSON objects they were recorded from.
+func (l *Logger) events() *mongo.Collection {
+	opts := options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
+	return l.client.Database(l.cfg.MongoDB).Collection("audit_events", opts)
+}
+
+func (l *Logger) Record(event models.AuditEvent) {
+	ctx, cancel := l.cfg.Context()
+	defer cancel()
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if _, err := l.events().InsertOne(ctx, event); err != nil {
+		log.Printf("audit %s %s/%s: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
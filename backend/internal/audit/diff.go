@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"go-mdbook/internal/models"
+)
+
+// Diff returns the fields that differ between two versions of an object,
+// keyed by their JSON names. Objects are compared through their JSON form,
+// so fields hidden from the API, such as password hashes and secrets, never
+// end up in the audit log. Either side may be nil for a created or deleted
+// object.
+func Diff(before, after any) map[string]models.Change {
+	b := fields(before)
+	a := fields(after)
+	changes := map[string]models.Change{}
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			changes[k] = models.Change{Before: v, After: a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = models.Change{After: v}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func fields(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+
+	"go-mdbook/internal/models"
+)
+
+func TestDiff(t *testing.T) {
+	before := models.User{Email: "a@example.com", Role: "reader", Active: true, PasswordHash: "old"}
+	after := before
+	after.Role = "editor"
+	after.PasswordHash = "new"
+
+	got := Diff(before, after)
+	want := map[string]models.Change{"role": {Before: "reader", After: "editor"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %#v, want %#v", got, want)
+	}
+	if got := Diff(before, before); got != nil {
+		t.Errorf("Diff of equal objects = %#v, want nil", got)
+	}
+}
+
+func TestDiffCreateDelete(t *testing.T) {
+	group := models.Group{Name: "docs", Role: "editor"}
+
+	created := Diff(nil, group)
+	if c, ok := created["name"]; !ok || c.Before != nil || c.After != "docs" {
+		t.Errorf("create name change = %#v", c)
+	}
+	deleted := Diff(group, nil)
+	if c, ok := deleted["role"]; !ok || c.Before != "editor" || c.After != nil {
+		t.Errorf("delete role change = %#v", c)
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	if q := (Filter{}).query(); len(q) != 0 {
+		t.Errorf("empty filter = %v, want no conditions", q)
+	}
+	q := Filter{Action: "book.delete", TargetType: "book"}.query()
+	if q["action"] != "book.delete" || q["target_type"] != "book" || len(q) != 2 {
+		t.Errorf("filter query = %v", q)
+	}
+}
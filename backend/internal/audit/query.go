@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"time"
+
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Filter selects audit events. Zero fields match everything; From is
+// inclusive and To exclusive.
+type Filter struct {
+	Action     string
+	ActorID    *primitive.ObjectID
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+}
+
+func (f Filter) query() bson.M {
+	q := bson.M{}
+	if f.Action != "" {
+		q["action"] = f.Action
+	}
+	if f.ActorID != nil {
+		q["actor_id"] = *f.ActorID
+	}
+	if f.TargetType != "" {
+		q["target_type"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		q["target_id"] = f.TargetID
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		t := bson.M{}
+		if !f.From.IsZero() {
+			t["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			t["$lt"] = f.To
+		}
+		q["time"] = t
+	}
+	return q
+}
+
+var newestFirst = bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}
+
+// List returns one page of matching events, newest first, and the total
+// number of matches.
+func (l *Logger) List(f Filter, page, limit int) ([]models.AuditEvent, int64, error) {
+	ctx, cancel := l.cfg.Context()
+	defer cancel()
+	q := f.query()
+	total, err := l.events().CountDocuments(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(newestFirst).SetSkip(int64((page - 1) * limit)).SetLimit(int64(limit))
+	cur, err := l.events().Find(ctx, q, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	list := []models.AuditEvent{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// Each calls fn for every matching event, newest first, stopping at the
+// first error.
+func (l *Logger) Each(f Filter, fn func(models.AuditEvent) error) error {
+	ctx, cancel := l.cfg.Context()
+	defer cancel()
+	cur, err := l.events().Find(ctx, f.query(), options.Find().SetSort(newestFirst))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var event models.AuditEvent
+		if err := cur.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
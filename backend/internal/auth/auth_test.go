@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -20,17 +21,55 @@ func TestHashAndCheckPassword(t *testing.T) {
 	}
 }
 
+func TestValidatePassword(t *testing.T) {
+	if err := ValidatePassword("short"); err == nil {
+		t.Fatalf("expected short password to fail")
+	}
+	if err := ValidatePassword(strings.Repeat("a", 73)); err == nil {
+		t.Fatalf("expected overlong password to fail")
+	}
+	if err := ValidatePassword("long enough"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestGenerateAndParseToken(t *testing.T) {
-	cfg := config.Config{JWTSecret: "test", TokenTTL: time.Hour}
-	token, err := GenerateToken(cfg, "user123", "admin")
+	keys := NewHMACKeySet("test", time.Hour)
+	token, err := keys.GenerateToken("user123", "admin", "session1")
 	if err != nil {
 		t.Fatalf("token error: %v", err)
 	}
-	claims, err := ParseToken(cfg, token)
+	claims, err := keys.ParseToken(token)
 	if err != nil {
 		t.Fatalf("parse error: %v", err)
 	}
-	if claims.UserID != "user123" || claims.Role != "admin" {
+	if claims.UserID != "user123" || claims.Role != "admin" || claims.SessionID != "session1" || claims.ID == "" {
 		t.Fatalf("unexpected claims: %#v", claims)
 	}
 }
+
+func TestContentToken(t *testing.T) {
+	cfg := config.Config{ContentSecret: "test"}
+	now := time.Now()
+	token := SignContentToken(cfg, ContentGrant{BookID: "book1", UserID: "user1", SessionID: "session1", ExpiresAt: now.Add(time.Minute)})
+
+	grant, err := ParseContentToken(cfg, token, now)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if grant.BookID != "book1" || grant.BuildID != "" || grant.UserID != "user1" || grant.SessionID != "session1" || grant.TokenID != "" {
+		t.Fatalf("unexpected grant: %#v", grant)
+	}
+	if _, err := ParseContentToken(cfg, token, now.Add(2*time.Minute)); err == nil {
+		t.Fatalf("expected expired token to fail")
+	}
+	if _, err := ParseContentToken(cfg, strings.Replace(token, "book1", "book2", 1), now); err == nil {
+		t.Fatalf("expected tampered token to fail")
+	}
+	if _, err := ParseContentToken(cfg, strings.Replace(token, "user1", "user2", 1), now); err == nil {
+		t.Fatalf("expected token moved to another user to fail")
+	}
+	if _, err := ParseContentToken(config.Config{ContentSecret: "other"}, token, now); err == nil {
+		t.Fatalf("expected token signed with another secret to fail")
+	}
+}
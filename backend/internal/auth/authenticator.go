@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity is an account an authenticator vouches for. Role is only set by
+// providers that manage roles themselves.
+type Identity struct {
+	Email  string
+	Role   string
+	Source string
+}
+
+// Authenticator checks a username and password against one account
+// source. It returns ErrInvalidCredentials when the credentials are wrong
+// or the account is unknown to it, so the next authenticator can be tried.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (Identity, error)
+}
+
+// PasswordAuthenticator checks local accounts against their bcrypt hash.
+// Lookup returns the stored hash for an email, or false if there is no
+// local account.
+type PasswordAuthenticator struct {
+	Lookup func(email string) (string, bool)
+}
+
+func (a PasswordAuthenticator) Name() string { return "local" }
+
+func (a PasswordAuthenticator) Authenticate(ctx context.Context, username, password string) (Identity, error) {
+	email := strings.ToLower(username)
+	hash, ok := a.Lookup(email)
+	if !ok || hash == "" || !CheckPassword(hash, password) {
+		return Identity{}, ErrInvalidCredentials
+	}
+	return Identity{Email: email}, nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/config"
+)
+
+var ErrInvalidContentToken = errors.New("invalid content token")
+
+// ContentGrant is what a signed content token gives access to: the
+// rendered output of one book, or of one of its builds when BuildID is set.
+// It also names who minted it, through a session or an API token, so the
+// link stops working when they lose access.
+type ContentGrant struct {
+	BookID    string
+	BuildID   string
+	UserID    string
+	SessionID string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// SignContentToken mints a token for embedding in content URLs. It travels
+// in the URL path rather than the query string so relative links inside the
+// rendered book inherit it.
+func SignContentToken(cfg config.Config, grant ContentGrant) string {
+	fields := []string{grant.BookID, grant.BuildID, grant.UserID, grant.SessionID, grant.TokenID}
+	for i, f := range fields {
+		if f == "" {
+			fields[i] = "_"
+		}
+	}
+	payload := strings.Join(fields, ".") + "." + strconv.FormatInt(grant.ExpiresAt.Unix(), 10)
+	return payload + "." + contentSignature(cfg, payload)
+}
+
+func ParseContentToken(cfg config.Config, token string, now time.Time) (ContentGrant, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 7 {
+		return ContentGrant{}, ErrInvalidContentToken
+	}
+	payload := strings.Join(parts[:6], ".")
+	if !hmac.Equal([]byte(parts[6]), []byte(contentSignature(cfg, payload))) {
+		return ContentGrant{}, ErrInvalidContentToken
+	}
+	exp, err := strconv.ParseInt(parts[5], 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return ContentGrant{}, ErrInvalidContentToken
+	}
+	for i, f := range parts[:5] {
+		if f == "_" {
+			parts[i] = ""
+		}
+	}
+	return ContentGrant{
+		BookID:    parts[0],
+		BuildID:   parts[1],
+		UserID:    parts[2],
+		SessionID: parts[3],
+		TokenID:   parts[4],
+		ExpiresAt: time.Unix(exp, 0),
+	}, nil
+}
+
+func contentSignature(cfg config.Config, payload string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.ContentSecret))
+	mac.Write([]byte("content:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSABits = 2048
+
+// Key is one signing key. Its ID is sent as the "kid" header so verifiers
+// can pick the matching public key.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// KeySet signs access tokens with its active key and verifies tokens signed
+// by any of its keys, so a new key can be made active while tokens signed
+// by the previous one stay valid until they expire. Without keys it falls
+// back to HS256 with JWT_SECRET, which only this server can verify.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	secret []byte
+	ttl    time.Duration
+}
+
+// LoadKeySet reads every *.pem private key (PKCS#8, or PKCS#1 for RSA) in
+// cfg.JWTKeysDir; the file name without extension is the key ID. RSA keys
+// sign with RS256 and Ed25519 keys with EdDSA.
+func LoadKeySet(cfg config.Config) (*KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		return NewHMACKeySet(cfg.JWTSecret, cfg.TokenTTL), nil
+	}
+	paths, err := filepath.Glob(filepath.Join(cfg.JWTKeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys, cfg.JWTActiveKey, cfg.TokenTTL)
+}
+
+// ParseKey decodes a PEM encoded private key.
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key must have at least %d bits", minRSABits)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, Private: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, Private: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// NewKeySet builds a key set signing with activeID. The ID may be empty
+// when there is exactly one key.
+func NewKeySet(keys []*Key, activeID string, ttl time.Duration) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	ks := &KeySet{keys: map[string]*Key{}, ttl: ttl}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key without id")
+		}
+		if _, dup := ks.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+	if activeID == "" && len(keys) == 1 {
+		activeID = keys[0].ID
+	}
+	ks.active = ks.keys[activeID]
+	if ks.active == nil {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	return ks, nil
+}
+
+func NewHMACKeySet(secret string, ttl time.Duration) *KeySet {
+	return &KeySet{secret: []byte(secret), ttl: ttl}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.Private)
+}
+
+// verificationKey picks the key for a token by its kid and refuses any
+// algorithm other than that key's own, so a token cannot pick how it is
+// verified.
+func (ks *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	if ks.active == nil {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return ks.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key := ks.keys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.Private.Public(), nil
+}
+
+func (ks *KeySet) methods() []string {
+	if ks.active == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public keys of the set for other services verifying
+// our tokens. It is empty in HS256 mode, where tokens cannot be verified
+// without the secret.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	b64 := base64.RawURLEncoding
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := JWK{Kid: id, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64.EncodeToString(pub.N.Bytes())
+			jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
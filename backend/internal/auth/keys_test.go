@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-mdbook/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKey(t *testing.T, dir, id string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testKeys(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2024-rsa", rsaKey)
+	writeKey(t, dir, "2025-ed", edKey)
+	return dir, rsaKey
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir, _ := testKeys(t)
+	cfg := config.Config{JWTKeysDir: dir, JWTActiveKey: "2024-rsa", TokenTTL: time.Hour}
+	old, err := LoadKeySet(cfg)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	token, err := old.GenerateToken("user1", "reader", "s1")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	cfg.JWTActiveKey = "2025-ed"
+	rotated, err := LoadKeySet(cfg)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if claims, err := rotated.ParseToken(token); err != nil || claims.UserID != "user1" {
+		t.Fatalf("token signed before rotation: %v %#v", err, claims)
+	}
+	fresh, err := rotated.GenerateToken("user2", "reader", "s2")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(fresh, &Claims{})
+	if err != nil || parsed.Header["kid"] != "2025-ed" || parsed.Method.Alg() != "EdDSA" {
+		t.Fatalf("unexpected header: %v %v", parsed.Header, err)
+	}
+	if _, err := rotated.ParseToken(fresh); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cfg.JWTActiveKey = "missing"
+	if _, err := LoadKeySet(cfg); err == nil {
+		t.Fatalf("expected an unknown active key to fail")
+	}
+}
+
+func TestKeySetRejectsForgedAlgorithms(t *testing.T) {
+	dir, rsaKey := testKeys(t)
+	keys, err := LoadKeySet(config.Config{JWTKeysDir: dir, JWTActiveKey: "2024-rsa", TokenTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	claims := Claims{UserID: "user1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+
+	// HS256 keyed with the published public key is the classic confusion
+	// attack against verifiers that trust the token's alg.
+	pub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hs.Header["kid"] = "2024-rsa"
+	forged, _ := hs.SignedString(pub)
+	if _, err := keys.ParseToken(forged); err == nil {
+		t.Fatalf("expected HS256 token to be rejected")
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	none.Header["kid"] = "2024-rsa"
+	unsigned, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := keys.ParseToken(unsigned); err == nil {
+		t.Fatalf("expected unsigned token to be rejected")
+	}
+
+	// A valid RS256 signature under a kid that names the EdDSA key.
+	rs := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	rs.Header["kid"] = "2025-ed"
+	mislabeled, _ := rs.SignedString(rsaKey)
+	if _, err := keys.ParseToken(mislabeled); err == nil {
+		t.Fatalf("expected algorithm mismatch with the key to be rejected")
+	}
+
+	hmacKeys := NewHMACKeySet("test", time.Hour)
+	rsSigned, _ := keys.GenerateToken("user1", "reader", "s1")
+	if _, err := hmacKeys.ParseToken(rsSigned); err == nil {
+		t.Fatalf("expected HS256 key set to reject RS256 tokens")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir, rsaKey := testKeys(t)
+	keys, err := LoadKeySet(config.Config{JWTKeysDir: dir, JWTActiveKey: "2025-ed", TokenTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(set.Keys))
+	}
+	rsaJWK, edJWK := set.Keys[0], set.Keys[1]
+	if rsaJWK.Kid != "2024-rsa" || rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.E != "AQAB" || rsaJWK.N == "" {
+		t.Errorf("unexpected RSA key: %#v", rsaJWK)
+	}
+	if edJWK.Kid != "2025-ed" || edJWK.Kty != "OKP" || edJWK.Crv != "Ed25519" || edJWK.Alg != "EdDSA" || edJWK.X == "" {
+		t.Errorf("unexpected Ed25519 key: %#v", edJWK)
+	}
+	if rsaJWK.N != base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()) {
+		t.Errorf("RSA modulus does not match the key")
+	}
+	if got := NewHMACKeySet("test", time.Hour).JWKS(); len(got.Keys) != 0 {
+		t.Errorf("HS256 key set must publish no keys, got %#v", got)
+	}
+}
+
+func TestParseKeyRejectsWeakRSA(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := x509.MarshalPKCS1PrivateKey(weak)
+	if _, err := ParseKey("weak", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})); err == nil {
+		t.Fatalf("expected a 1024-bit RSA key to be rejected")
+	}
+}
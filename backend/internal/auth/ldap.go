@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// LDAPAuthenticator binds to a directory as the user, then reads the
+// user's entry for their email and group memberships.
+type LDAPAuthenticator struct {
+	cfg config.Config
+}
+
+func NewLDAPAuthenticator(cfg config.Config) *LDAPAuthenticator {
+	return &LDAPAuthenticator{cfg: cfg}
+}
+
+func (a *LDAPAuthenticator) Name() string { return models.AuthSourceLDAP }
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (Identity, error) {
+	// An empty password makes the bind unauthenticated, which most
+	// directories accept for any DN.
+	if username == "" || password == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	conn, err := ldap.DialURL(a.cfg.LDAPURL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return Identity{}, fmt.Errorf("ldap dial: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(ldapTimeout)
+	if a.cfg.LDAPStartTLS {
+		u, err := url.Parse(a.cfg.LDAPURL)
+		if err != nil {
+			return Identity{}, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			return Identity{}, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+
+	bindDN := strings.ReplaceAll(a.cfg.LDAPBindDN, "{username}", ldap.EscapeDN(username))
+	if err := conn.Bind(bindDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Identity{}, ErrInvalidCredentials
+		}
+		return Identity{}, fmt.Errorf("ldap bind: %w", err)
+	}
+
+	filter := strings.ReplaceAll(a.cfg.LDAPUserFilter, "{username}", ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.LDAPSearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false, filter,
+		[]string{a.cfg.LDAPEmailAttr, a.cfg.LDAPGroupAttr}, nil,
+	))
+	if err != nil {
+		return Identity{}, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return Identity{}, fmt.Errorf("ldap search: expected one entry for %q, found %d", username, len(res.Entries))
+	}
+	entry := res.Entries[0]
+
+	email := entry.GetAttributeValue(a.cfg.LDAPEmailAttr)
+	if email == "" {
+		return Identity{}, errors.New("ldap entry has no email address")
+	}
+	return Identity{
+		Email:  strings.ToLower(email),
+		Role:   a.role(entry.GetAttributeValues(a.cfg.LDAPGroupAttr)),
+		Source: models.AuthSourceLDAP,
+	}, nil
+}
+
+// role maps group DNs onto the most privileged configured role. DNs are
+// compared case-insensitively, as directories do.
+func (a *LDAPAuthenticator) role(groups []string) string {
+	roles := []string{}
+	for _, g := range groups {
+		for dn, role := range a.cfg.LDAPRoleMapping {
+			if strings.EqualFold(strings.TrimSpace(g), dn) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	if role := access.HighestRole(roles...); role != "" {
+		return role
+	}
+	if access.ValidRole(a.cfg.LDAPDefaultRole) {
+		return a.cfg.LDAPDefaultRole
+	}
+	return access.RoleReader
+}
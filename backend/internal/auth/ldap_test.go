@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"go-mdbook/internal/config"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+type ldapEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// ldapServer answers simple binds and equality searches over a fixed set
+// of entries, which is all LDAPAuthenticator needs.
+type ldapServer struct {
+	t       *testing.T
+	ln      net.Listener
+	entries []ldapEntry
+}
+
+func newLDAPServer(t *testing.T, entries ...ldapEntry) *ldapServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapServer{t: t, ln: ln, entries: entries}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *ldapServer) url() string { return "ldap://" + s.ln.Addr().String() }
+
+func (s *ldapServer) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ber.Tag(0): // bind
+			name := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := int64(49) // invalid credentials
+			for _, e := range s.entries {
+				if strings.EqualFold(e.dn, name) && e.password == password && password != "" {
+					code, bound = 0, true
+				}
+			}
+			s.write(conn, id, result(1, code))
+		case ber.Tag(2): // unbind
+			return
+		case ber.Tag(3): // search
+			if !bound {
+				s.write(conn, id, result(5, 50))
+				continue
+			}
+			filter := op.Children[6]
+			attr := filter.Children[0].Value.(string)
+			value := filter.Children[1].Value.(string)
+			for _, e := range s.entries {
+				for _, v := range e.attrs[attr] {
+					if v == value {
+						s.write(conn, id, entryPacket(e))
+					}
+				}
+			}
+			s.write(conn, id, result(5, 0))
+		default:
+			s.t.Errorf("unexpected LDAP operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+func (s *ldapServer) write(conn net.Conn, id int64, op *ber.Packet) {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	msg.AppendChild(op)
+	if _, err := conn.Write(msg.Bytes()); err != nil {
+		s.t.Error(err)
+	}
+}
+
+func result(tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return op
+}
+
+func entryPacket(e ldapEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 4, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+func testLDAP(t *testing.T) *LDAPAuthenticator {
+	server := newLDAPServer(t,
+		ldapEntry{
+			dn:       "uid=ada,ou=people,dc=example,dc=org",
+			password: "s3cret",
+			attrs: map[string][]string{
+				"uid":      {"ada"},
+				"mail":     {"Ada@Example.org"},
+				"memberOf": {"cn=staff,ou=groups,dc=example,dc=org", "CN=Writers,ou=groups,dc=example,dc=org"},
+			},
+		},
+		ldapEntry{
+			dn:       "uid=bob,ou=people,dc=example,dc=org",
+			password: "hunter22",
+			attrs:    map[string][]string{"uid": {"bob"}, "mail": {"bob@example.org"}},
+		},
+	)
+	return NewLDAPAuthenticator(config.Config{
+		LDAPURL:        server.url(),
+		LDAPBindDN:     "uid={username},ou=people,dc=example,dc=org",
+		LDAPSearchBase: "ou=people,dc=example,dc=org",
+		LDAPUserFilter: "(uid={username})",
+		LDAPEmailAttr:  "mail",
+		LDAPGroupAttr:  "memberOf",
+		LDAPRoleMapping: map[string]string{
+			"cn=writers,ou=groups,dc=example,dc=org": "editor",
+			"cn=ops,ou=groups,dc=example,dc=org":     "admin",
+		},
+		LDAPDefaultRole: "reader",
+	})
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	a := testLDAP(t)
+
+	identity, err := a.Authenticate(context.Background(), "ada", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity != (Identity{Email: "ada@example.org", Role: "editor", Source: "ldap"}) {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	identity, err = a.Authenticate(context.Background(), "bob", "hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "reader" {
+		t.Fatalf("expected default role, got %q", identity.Role)
+	}
+}
+
+func TestLDAPRejectsBadCredentials(t *testing.T) {
+	a := testLDAP(t)
+	cases := []struct{ username, password string }{
+		{"ada", "wrong"},
+		{"ada", ""},
+		{"nobody", "s3cret"},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		_, err := a.Authenticate(context.Background(), tc.username, tc.password)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", tc.username, tc.password, err)
+		}
+	}
+}
+
+func TestPasswordAuthenticator(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := PasswordAuthenticator{Lookup: func(email string) (string, bool) {
+		switch email {
+		case "ada@example.org":
+			return hash, true
+		case "sso@example.org":
+			return "", true
+		}
+		return "", false
+	}}
+
+	identity, err := a.Authenticate(context.Background(), "Ada@example.org", "correct horse")
+	if err != nil || identity.Email != "ada@example.org" || identity.Source != "" {
+		t.Fatalf("unexpected result %+v, %v", identity, err)
+	}
+	for _, tc := range []struct{ email, password string }{
+		{"ada@example.org", "wrong"},
+		{"sso@example.org", ""},
+		{"nobody@example.org", "correct horse"},
+	} {
+		if _, err := a.Authenticate(context.Background(), tc.email, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidCredentials", tc.email, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"go-mdbook/internal/config"
+)
+
+// RFC 6238 appendix B, SHA-1, truncated to six digits.
+func TestTOTPCodeVectors(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range cases {
+		got, err := TOTPCode(secret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := TOTPCode(secret, now)
+
+	step, ok := VerifyTOTP(secret, code, now)
+	if !ok || step != now.Unix()/30 {
+		t.Fatalf("expected current code to verify at step %d, got %d, %v", now.Unix()/30, step, ok)
+	}
+	if _, ok := VerifyTOTP(secret, code, now.Add(30*time.Second)); !ok {
+		t.Fatal("expected code from the previous step to be accepted")
+	}
+	if _, ok := VerifyTOTP(secret, code, now.Add(2*time.Minute)); ok {
+		t.Fatal("expected stale code to be rejected")
+	}
+	if _, ok := VerifyTOTP(secret, "12345", now); ok {
+		t.Fatal("expected short code to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' || seen[c] {
+			t.Fatalf("unexpected recovery code %q", c)
+		}
+		seen[c] = true
+		if NormalizeRecoveryCode(" "+c[:5]+c[6:]+" ") != c {
+			t.Fatalf("normalize did not restore %q", c)
+		}
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	cfg := config.Config{JWTSecret: "secret"}
+	now := time.Now()
+	token := SignMFAToken(cfg, "user1", now)
+
+	userID, err := ParseMFAToken(cfg, token, now)
+	if err != nil || userID != "user1" {
+		t.Fatalf("ParseMFAToken = %q, %v", userID, err)
+	}
+	if _, err := ParseMFAToken(cfg, token, now.Add(MFATokenTTL)); err != ErrInvalidMFAToken {
+		t.Fatal("expected expired token to be rejected")
+	}
+	if _, err := ParseMFAToken(config.Config{JWTSecret: "other"}, token, now); err != ErrInvalidMFAToken {
+		t.Fatal("expected token signed with another secret to be rejected")
+	}
+	if _, err := ParseContentToken(cfg, token, now); err == nil {
+		t.Fatal("mfa token must not be accepted as a content token")
+	}
+}
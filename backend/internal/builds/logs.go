@@ -0,0 +1,105 @@
+package builds
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// logHub tracks which builds are queued or running in this process and wakes log
+// followers whenever a new line has been stored. Followers re-read the
+// stored log themselves, so a slow follower never loses lines.
+type logHub struct {
+	mu   sync.Mutex
+	subs map[primitive.ObjectID]map[chan struct{}]struct{}
+}
+
+func (h *logHub) open(buildID primitive.ObjectID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = map[primitive.ObjectID]map[chan struct{}]struct{}{}
+	}
+	if _, ok := h.subs[buildID]; !ok {
+		h.subs[buildID] = map[chan struct{}]struct{}{}
+	}
+}
+
+func (h *logHub) notify(buildID primitive.ObjectID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[buildID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *logHub) close(buildID primitive.ObjectID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[buildID] {
+		close(ch)
+	}
+	delete(h.subs, buildID)
+}
+
+// Follow subscribes to new log lines of a build queued or running in this
+// process. The channel receives a signal after lines are stored and is
+// closed once the build's final status has been recorded. ok is false when
+// the build is not queued or running here, in which case the stored log is
+// already complete.
+func (q *Queue) Follow(buildID primitive.ObjectID) (updates <-chan struct{}, stop func(), ok bool) {
+	q.logs.mu.Lock()
+	defer q.logs.mu.Unlock()
+	subs, live := q.logs.subs[buildID]
+	if !live {
+		return nil, func() {}, false
+	}
+	ch := make(chan struct{}, 1)
+	subs[ch] = struct{}{}
+	stop = func() {
+		q.logs.mu.Lock()
+		defer q.logs.mu.Unlock()
+		if subs, live := q.logs.subs[buildID]; live {
+			if _, ok := subs[ch]; ok {
+				delete(subs, ch)
+				close(ch)
+			}
+		}
+	}
+	return ch, stop, true
+}
+
+// buildLogger stores output lines of one build in order of arrival.
+type buildLogger struct {
+	q       *Queue
+	buildID primitive.ObjectID
+	mu      sync.Mutex
+	seq     int
+}
+
+func (l *buildLogger) line(stream, text string) {
+	ctx, cancel := l.q.cfg.Context()
+	defer cancel()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	entry := models.BuildLogLine{
+		BuildID: l.buildID,
+		Seq:     l.seq,
+		Stream:  stream,
+		Text:    text,
+		Time:    time.Now(),
+	}
+	if _, err := l.q.buildLogs().InsertOne(ctx, entry); err != nil {
+		log.Printf("build %s: store log line: %v", l.buildID.Hex(), err)
+		return
+	}
+	l.q.logs.notify(l.buildID)
+}
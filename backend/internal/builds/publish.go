@@ -0,0 +1,122 @@
+package builds
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNotPublishable = errors.New("build has no output to publish")
+
+// Publish pins the book to build: readers are served its output until the
+// book is unpublished, and newer builds only become available as previews.
+func (q *Queue) Publish(book models.Book, build models.Build) error {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	if build.BookID != book.ID || build.Status != models.BuildSucceeded || build.OutputDir == "" || build.Pruned {
+		return ErrNotPublishable
+	}
+	_, err := q.books().UpdateByID(ctx, book.ID, bson.M{"$set": bson.M{
+		"published_build_id": build.ID,
+		"current_build_id":   build.ID,
+		"output_dir":         build.OutputDir,
+	}})
+	return err
+}
+
+// Unpublish removes the pin and serves the newest successful build again.
+func (q *Queue) Unpublish(book models.Book) error {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	set := bson.M{}
+	latest, err := q.retained(book.ID)
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 {
+		set["current_build_id"] = latest[0].ID
+		set["output_dir"] = latest[0].OutputDir
+	}
+	update := bson.M{"$unset": bson.M{"published_build_id": ""}}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	_, err = q.books().UpdateByID(ctx, book.ID, update)
+	return err
+}
+
+// retained lists a book's successful builds whose output still exists,
+// newest first.
+func (q *Queue) retained(bookID primitive.ObjectID) ([]models.Build, error) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cur, err := q.builds().Find(ctx, bson.M{
+		"book_id":    bookID,
+		"status":     models.BuildSucceeded,
+		"output_dir": bson.M{"$exists": true},
+		"pruned":     bson.M{"$ne": true},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	list := []models.Build{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// prune deletes the output of successful builds beyond the newest
+// BuildRetention, never touching the build being served or the published
+// one. The build records themselves are kept and marked pruned.
+func (q *Queue) prune(bookID primitive.ObjectID) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	keep := q.cfg.BuildRetention
+	if keep < 1 {
+		keep = 1
+	}
+	var book models.Book
+	if err := q.books().FindOne(ctx, bson.M{"_id": bookID}).Decode(&book); err != nil {
+		return
+	}
+	list, err := q.retained(bookID)
+	if err != nil {
+		log.Printf("book %s: list builds to prune: %v", bookID.Hex(), err)
+		return
+	}
+	for i, build := range list {
+		if i < keep || isBuild(book.CurrentBuildID, build.ID) || isBuild(book.PublishedBuildID, build.ID) {
+			continue
+		}
+		if err := os.RemoveAll(build.OutputDir); err != nil {
+			log.Printf("build %s: prune output: %v", build.ID.Hex(), err)
+			continue
+		}
+		if err := q.markPruned(build.ID); err != nil {
+			log.Printf("build %s: mark pruned: %v", build.ID.Hex(), err)
+		}
+	}
+}
+
+func (q *Queue) markPruned(buildID primitive.ObjectID) error {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	_, err := q.builds().UpdateByID(ctx, buildID, bson.M{
+		"$set":   bson.M{"pruned": true},
+		"$unset": bson.M{"output_dir": ""},
+	})
+	return err
+}
+
+func isBuild(id *primitive.ObjectID, buildID primitive.ObjectID) bool {
+	return id != nil && *id == buildID
+}
@@ -0,0 +1,485 @@
+package builds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+	"go-mdbook/internal/services"
+	"go-mdbook/internal/sources"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotCancellable = errors.New("build already finished")
+	errCancelled      = errors.New("build cancelled")
+)
+
+type job struct {
+	buildID primitive.ObjectID
+	bookID  primitive.ObjectID
+}
+
+// Queue runs book builds on a bounded pool of workers. Builds of the same
+// book never run concurrently: while one is in flight, later builds of that
+// book wait in pending and are released one at a time as it finishes.
+type Queue struct {
+	cfg     config.Config
+	client  *mongo.Client
+	sources *sources.Store
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []job
+	active  map[primitive.ObjectID]bool
+	pending map[primitive.ObjectID][]job
+	stopped bool
+	running map[primitive.ObjectID]context.CancelCauseFunc
+
+	logs logHub
+}
+
+func NewQueue(cfg config.Config, client *mongo.Client, store *sources.Store) *Queue {
+	q := &Queue{
+		cfg:     cfg,
+		client:  client,
+		sources: store,
+		active:  map[primitive.ObjectID]bool{},
+		pending: map[primitive.ObjectID][]job{},
+		running: map[primitive.ObjectID]context.CancelCauseFunc{},
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *Queue) builds() *mongo.Collection {
+	return q.client.Database(q.cfg.MongoDB).Collection("builds")
+}
+
+func (q *Queue) buildLogs() *mongo.Collection {
+	return q.client.Database(q.cfg.MongoDB).Collection("build_logs")
+}
+
+func (q *Queue) books() *mongo.Collection {
+	return q.client.Database(q.cfg.MongoDB).Collection("books")
+}
+
+// Start recovers builds left over from a previous run and launches the
+// workers. Workers exit once ctx is done.
+func (q *Queue) Start(ctx context.Context) error {
+	if err := q.recover(); err != nil {
+		return err
+	}
+	workers := q.cfg.BuildWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	go func() {
+		<-ctx.Done()
+		q.mu.Lock()
+		q.stopped = true
+		q.mu.Unlock()
+		q.cond.Broadcast()
+	}()
+	return nil
+}
+
+// recover fails builds that were running when the server stopped and
+// requeues the ones that never started.
+func (q *Queue) recover() error {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	now := time.Now()
+	_, err := q.builds().UpdateMany(ctx,
+		bson.M{"status": models.BuildRunning},
+		bson.M{"$set": bson.M{"status": models.BuildFailed, "error": "interrupted by server restart", "finished_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := q.builds().Find(ctx, bson.M{"status": models.BuildQueued}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	queued := []models.Build{}
+	if err := cur.All(ctx, &queued); err != nil {
+		return err
+	}
+	for _, b := range queued {
+		q.dispatch(job{buildID: b.ID, bookID: b.BookID})
+	}
+	return nil
+}
+
+// Enqueue records a queued build for book and schedules it. A revision of
+// 0 builds a copy of whatever is in the book's SourceDir when the build
+// starts.
+func (q *Queue) Enqueue(book models.Book, userID primitive.ObjectID, revision int) (models.Build, error) {
+	return q.enqueue(models.Build{
+		BookID:      book.ID,
+		Status:      models.BuildQueued,
+		TriggeredBy: userID,
+		Revision:    revision,
+	})
+}
+
+// EnqueueSync schedules a build that first syncs the book's Git source, on
+// behalf of trigger rather than a user. While such a build is still
+// queued, it is returned instead of queueing another: it will pick up the
+// latest commit anyway.
+func (q *Queue) EnqueueSync(book models.Book, trigger string) (models.Build, error) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	var queued models.Build
+	err := q.builds().FindOne(ctx, bson.M{"book_id": book.ID, "status": models.BuildQueued, "sync": true}).Decode(&queued)
+	if err == nil {
+		return queued, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Build{}, err
+	}
+	return q.enqueue(models.Build{
+		BookID:  book.ID,
+		Status:  models.BuildQueued,
+		Sync:    true,
+		Trigger: trigger,
+	})
+}
+
+func (q *Queue) enqueue(build models.Build) (models.Build, error) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	build.CreatedAt = time.Now()
+	var numbered models.Book
+	err := q.books().FindOneAndUpdate(ctx,
+		bson.M{"_id": build.BookID},
+		bson.M{"$inc": bson.M{"build_seq": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&numbered)
+	if err != nil {
+		return models.Build{}, err
+	}
+	build.Number = numbered.BuildSeq
+
+	// Followers may subscribe as soon as the build is visible.
+	build.ID = primitive.NewObjectID()
+	q.logs.open(build.ID)
+	if _, err := q.builds().InsertOne(ctx, build); err != nil {
+		q.logs.close(build.ID)
+		return models.Build{}, err
+	}
+	q.dispatch(job{buildID: build.ID, bookID: build.BookID})
+	return build, nil
+}
+
+func (q *Queue) dispatch(j job) {
+	q.logs.open(j.buildID)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active[j.bookID] {
+		q.pending[j.bookID] = append(q.pending[j.bookID], j)
+		return
+	}
+	q.active[j.bookID] = true
+	q.ready = append(q.ready, j)
+	q.cond.Signal()
+}
+
+func (q *Queue) done(bookID primitive.ObjectID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	next := q.pending[bookID]
+	if len(next) == 0 {
+		delete(q.pending, bookID)
+		delete(q.active, bookID)
+		return
+	}
+	q.pending[bookID] = next[1:]
+	q.ready = append(q.ready, next[0])
+	q.cond.Signal()
+}
+
+func (q *Queue) worker() {
+	for {
+		q.mu.Lock()
+		for len(q.ready) == 0 && !q.stopped {
+			q.cond.Wait()
+		}
+		if q.stopped {
+			q.mu.Unlock()
+			return
+		}
+		j := q.ready[0]
+		q.ready = q.ready[1:]
+		q.mu.Unlock()
+
+		q.run(j)
+		q.done(j.bookID)
+	}
+}
+
+// Cancel stops a queued or running build. Queued builds are marked
+// cancelled right away; running ones are killed and recorded as cancelled
+// by their worker.
+func (q *Queue) Cancel(buildID primitive.ObjectID) error {
+	q.mu.Lock()
+	stop, ok := q.running[buildID]
+	q.mu.Unlock()
+	if ok {
+		stop(errCancelled)
+		return nil
+	}
+
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	res, err := q.builds().UpdateOne(ctx,
+		bson.M{"_id": buildID, "status": models.BuildQueued},
+		bson.M{"$set": bson.M{"status": models.BuildCancelled, "finished_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNotCancellable
+	}
+	q.logs.close(buildID)
+	return nil
+}
+
+func (q *Queue) run(j job) {
+	// Followers subscribed since the build was queued; release them once
+	// its outcome is recorded, whichever way it goes.
+	defer q.logs.close(j.buildID)
+	// Register the cancel func before the build is visibly running so a
+	// concurrent Cancel either finds it here or still sees it queued.
+	parent, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	q.mu.Lock()
+	q.running[j.buildID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, j.buildID)
+		q.mu.Unlock()
+	}()
+
+	dbCtx, dbCancel := q.cfg.Context()
+	defer dbCancel()
+	var build models.Build
+	err := q.builds().FindOneAndUpdate(dbCtx,
+		bson.M{"_id": j.buildID, "status": models.BuildQueued},
+		bson.M{"$set": bson.M{"status": models.BuildRunning, "started_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&build)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+	if err != nil {
+		log.Printf("build %s: mark running: %v", j.buildID.Hex(), err)
+		q.finish(j.buildID, models.BuildFailed, err)
+		return
+	}
+	var book models.Book
+	err = q.books().FindOne(dbCtx, bson.M{"_id": j.bookID}).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		q.finish(j.buildID, models.BuildFailed, errors.New("book not found"))
+		return
+	}
+	if err != nil {
+		q.finish(j.buildID, models.BuildFailed, err)
+		return
+	}
+
+	ctx, stop := parent, context.CancelFunc(func() {})
+	if q.cfg.BuildTimeout > 0 {
+		ctx, stop = context.WithTimeout(parent, q.cfg.BuildTimeout)
+	}
+	defer stop()
+	logger := &buildLogger{q: q, buildID: j.buildID}
+	if build.Sync {
+		if book, err = q.sync(ctx, book, build, logger); err != nil {
+			q.finish(j.buildID, outcome(ctx, err), err)
+			return
+		}
+	}
+	sourceDir, cleanup, err := q.checkout(book, &build)
+	if err != nil {
+		q.finish(j.buildID, models.BuildFailed, err)
+		return
+	}
+	defer cleanup()
+
+	staging := outputDir(book, j.buildID)
+	err = services.BuildBook(ctx, sourceDir, staging, logger.line)
+	if err == nil {
+		err = q.swapOutput(book, j.buildID, staging)
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+	} else {
+		q.recordCommit(book, build)
+	}
+	q.finish(j.buildID, outcome(ctx, err), err)
+}
+
+// sync imports the latest commit of the book's Git source before a sync
+// build and returns the book as it is afterwards.
+func (q *Queue) sync(ctx context.Context, book models.Book, build models.Build, logger *buildLogger) (models.Book, error) {
+	if book.Git == nil {
+		return book, sources.ErrNoGitSource
+	}
+	logger.line("stdout", "Syncing "+book.Git.URL+" "+book.Git.Ref)
+	rev, changed, err := q.sources.Sync(ctx, book, build.TriggeredBy)
+	if err != nil {
+		return book, fmt.Errorf("sync: %w", err)
+	}
+	if changed {
+		logger.line("stdout", fmt.Sprintf("Imported commit %s as revision %d", rev.Commit, rev.Number))
+	} else {
+		logger.line("stdout", fmt.Sprintf("Commit %s is already revision %d", rev.Commit, rev.Number))
+	}
+	book.ActiveRevision = rev.Number
+	book.GitSHA = rev.Commit
+	dbCtx, cancel := q.cfg.Context()
+	defer cancel()
+	_, err = q.builds().UpdateByID(dbCtx, build.ID, bson.M{"$set": bson.M{"commit": rev.Commit}})
+	if err != nil {
+		log.Printf("build %s: record commit: %v", build.ID.Hex(), err)
+	}
+	return book, nil
+}
+
+// checkout returns a private copy of the source to build from, so later
+// uploads cannot change it mid-build. Builds of a specific revision extract
+// it; other builds copy the book's SourceDir and record on build which
+// revision that was.
+func (q *Queue) checkout(book models.Book, build *models.Build) (string, func(), error) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	dir, err := os.MkdirTemp("", "mdbook-src-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	if build.Revision == 0 {
+		active, err := q.sources.Snapshot(book, dir)
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("copy source: %w", err)
+		}
+		if active > 0 {
+			build.Revision = active
+			_, err := q.builds().UpdateByID(ctx, build.ID, bson.M{"$set": bson.M{"revision": active}})
+			if err != nil {
+				log.Printf("build %s: record revision: %v", build.ID.Hex(), err)
+			}
+		}
+		return dir, cleanup, nil
+	}
+
+	rev, err := q.sources.Get(book.ID, build.Revision)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if err := q.sources.Checkout(rev, dir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("checkout revision %d: %w", rev.Number, err)
+	}
+	return dir, cleanup, nil
+}
+
+// recordCommit notes the Git commit a successful build rendered, if its
+// revision was synced from one, on the build and as the book's last built
+// commit.
+func (q *Queue) recordCommit(book models.Book, build models.Build) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	number := build.Revision
+	if number == 0 {
+		number = book.ActiveRevision
+	}
+	if number == 0 {
+		return
+	}
+	rev, err := q.sources.Get(book.ID, number)
+	if err != nil || rev.Commit == "" {
+		return
+	}
+	if _, err := q.builds().UpdateByID(ctx, build.ID, bson.M{"$set": bson.M{"commit": rev.Commit}}); err != nil {
+		log.Printf("build %s: record commit: %v", build.ID.Hex(), err)
+	}
+	if _, err := q.books().UpdateByID(ctx, book.ID, bson.M{"$set": bson.M{"last_built_sha": rev.Commit}}); err != nil {
+		log.Printf("build %s: record last built commit: %v", build.ID.Hex(), err)
+	}
+}
+
+// outputDir is where a build renders. Every build gets a fresh directory so
+// the output being served is never written to.
+func outputDir(book models.Book, buildID primitive.ObjectID) string {
+	return filepath.Join(book.BuildDir, "out", buildID.Hex())
+}
+
+// swapOutput records the build's output directory and, unless the book
+// is pinned to a published build, makes it the output served to readers.
+// The condition on published_build_id keeps a concurrent Publish from
+// being overridden.
+func (q *Queue) swapOutput(book models.Book, buildID primitive.ObjectID, dir string) error {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	_, err := q.builds().UpdateByID(ctx, buildID, bson.M{"$set": bson.M{"output_dir": dir}})
+	if err != nil {
+		return fmt.Errorf("record build output: %w", err)
+	}
+	_, err = q.books().UpdateOne(ctx,
+		bson.M{"_id": book.ID, "published_build_id": nil},
+		bson.M{"$set": bson.M{"output_dir": dir, "current_build_id": buildID}},
+	)
+	if err != nil {
+		return fmt.Errorf("publish build output: %w", err)
+	}
+	q.prune(book.ID)
+	return nil
+}
+
+func outcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return models.BuildSucceeded
+	case errors.Is(context.Cause(ctx), errCancelled):
+		return models.BuildCancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return models.BuildTimedOut
+	default:
+		return models.BuildFailed
+	}
+}
+
+func (q *Queue) finish(buildID primitive.ObjectID, status string, buildErr error) {
+	ctx, cancel := q.cfg.Context()
+	defer cancel()
+	update := bson.M{"status": status, "finished_at": time.Now()}
+	if buildErr != nil {
+		update["error"] = buildErr.Error()
+	}
+	if _, err := q.builds().UpdateByID(ctx, buildID, bson.M{"$set": update}); err != nil {
+		log.Printf("build %s: record result: %v", buildID.Hex(), err)
+	}
+}
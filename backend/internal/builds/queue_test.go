@@ -0,0 +1,60 @@
+package builds
+
+import (
+	"testing"
+
+	"go-mdbook/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDispatchSerializesPerBook(t *testing.T) {
+	q := NewQueue(config.Config{}, nil, nil)
+	bookA, bookB := primitive.NewObjectID(), primitive.NewObjectID()
+	first := job{buildID: primitive.NewObjectID(), bookID: bookA}
+	second := job{buildID: primitive.NewObjectID(), bookID: bookA}
+	other := job{buildID: primitive.NewObjectID(), bookID: bookB}
+
+	q.dispatch(first)
+	q.dispatch(second)
+	q.dispatch(other)
+	if len(q.ready) != 2 || q.ready[0] != first || q.ready[1] != other {
+		t.Fatalf("unexpected ready jobs: %#v", q.ready)
+	}
+	if len(q.pending[bookA]) != 1 {
+		t.Fatalf("expected second build of book to wait, got %#v", q.pending)
+	}
+
+	q.ready = nil
+	q.done(bookA)
+	if len(q.ready) != 1 || q.ready[0] != second {
+		t.Fatalf("expected pending build to be released, got %#v", q.ready)
+	}
+	q.ready = nil
+	q.done(bookA)
+	if q.active[bookA] || len(q.ready) != 0 {
+		t.Fatalf("expected book to be idle")
+	}
+}
+
+func TestFollowQueuedBuild(t *testing.T) {
+	q := NewQueue(config.Config{}, nil, nil)
+	j := job{buildID: primitive.NewObjectID(), bookID: primitive.NewObjectID()}
+	q.dispatch(j)
+	updates, stop, live := q.Follow(j.buildID)
+	defer stop()
+	if !live {
+		t.Fatal("expected a queued build to be followable")
+	}
+
+	// Dispatching again, as recovery does, keeps existing followers.
+	q.dispatch(j)
+	q.logs.notify(j.buildID)
+	if _, open := <-updates; !open {
+		t.Fatal("expected a notification")
+	}
+	q.logs.close(j.buildID)
+	if _, open := <-updates; open {
+		t.Fatal("expected updates to close with the build")
+	}
+}
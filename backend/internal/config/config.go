@@ -2,39 +2,191 @@ package config
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// DefaultJWTSecret is the development fallback for JWT_SECRET. Validate
+// refuses it outside dev mode.
+const DefaultJWTSecret = "dev_secret_change_me"
+
+// MinSecretLength is the shortest JWT_SECRET or CONTENT_URL_SECRET Validate
+// accepts outside dev mode. Placeholders such as "change_me" are shorter.
+const MinSecretLength = 32
+
 type Config struct {
+	AppEnv         string
+	SiteName       string
 	APIAddr        string
 	MongoURI       string
 	MongoDB        string
 	JWTSecret      string
+	JWTKeysDir     string
+	JWTActiveKey   string
 	TokenTTL       time.Duration
+	RefreshTTL     time.Duration
+	ResetTokenTTL  time.Duration
+	InviteTTL      time.Duration
+	ContentSecret  string
+	ContentURLTTL  time.Duration
+	TOTPIssuer     string
+	TrustedProxies []string
 	AdminEmail     string
 	AdminPassword  string
 	BooksRoot      string
 	BooksBuildRoot string
+	RevisionsRoot  string
+	GitCacheDir    string
+	GitCredsDir    string
+	GitCredScopes  map[string][]string
+	GitTimeout     time.Duration
+	GitAllowFile   bool
+	GitPoll        time.Duration
+	BuildWorkers   int
+	BuildTimeout   time.Duration
+	BuildRetention int
+
+	// Limits on uploads and on unpacking source archives; sizes in bytes.
+	UploadMaxSize   int64
+	ZipMaxEntries   int
+	ZipMaxFileSize  int64
+	ZipMaxTotalSize int64
+	ZipMaxRatio     int64
+
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginLockout       time.Duration
+	LoginLockoutMax    time.Duration
+
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	FrontendURL        string
+	OIDCIssuer         string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         []string
+	OIDCGroupsClaim    string
+	OIDCRoleMapping    map[string]string
+	OIDCDefaultRole    string
+	OIDCAssumeVerified bool
+
+	LDAPURL         string
+	LDAPStartTLS    bool
+	LDAPBindDN      string
+	LDAPSearchBase  string
+	LDAPUserFilter  string
+	LDAPEmailAttr   string
+	LDAPGroupAttr   string
+	LDAPRoleMapping map[string]string
+	LDAPDefaultRole string
 }
 
 func Load() Config {
+	jwtSecret := getEnv("JWT_SECRET", DefaultJWTSecret)
+	siteName := getEnv("SITE_NAME", "go-mdbook")
 	return Config{
+		AppEnv:         getEnv("APP_ENV", "production"),
+		SiteName:       siteName,
 		APIAddr:        getEnv("API_ADDR", ":8080"),
 		MongoURI:       getEnv("MONGO_URI", "mongodb://mongo:27017"),
 		MongoDB:        getEnv("MONGO_DB", "mdbook"),
-		JWTSecret:      getEnv("JWT_SECRET", "dev_secret_change_me"),
-		TokenTTL:       getDuration("TOKEN_TTL", 24*time.Hour),
+		JWTSecret:      jwtSecret,
+		JWTKeysDir:     getEnv("JWT_KEYS_DIR", ""),
+		JWTActiveKey:   getEnv("JWT_ACTIVE_KID", ""),
+		TokenTTL:       getDuration("TOKEN_TTL", 15*time.Minute),
+		RefreshTTL:     getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		ResetTokenTTL:  getDuration("PASSWORD_RESET_TTL", 24*time.Hour),
+		InviteTTL:      getDuration("INVITE_TTL", 7*24*time.Hour),
+		ContentSecret:  getEnv("CONTENT_URL_SECRET", jwtSecret),
+		ContentURLTTL:  getDuration("CONTENT_URL_TTL", time.Hour),
+		TOTPIssuer:     getEnv("TOTP_ISSUER", siteName),
+		TrustedProxies: getList("TRUSTED_PROXIES", nil),
 		AdminEmail:     getEnv("ADMIN_EMAIL", "admin@example.com"),
 		AdminPassword:  getEnv("ADMIN_PASSWORD", "admin123"),
 		BooksRoot:      getEnv("BOOKS_ROOT", "/data/books"),
 		BooksBuildRoot: getEnv("BOOKS_BUILD_ROOT", "/data/build"),
+		RevisionsRoot:  getEnv("BOOKS_REVISIONS_ROOT", "/data/revisions"),
+		GitCacheDir:    getEnv("GIT_CACHE_DIR", "/data/git"),
+		GitCredsDir:    os.Getenv("GIT_CREDENTIALS_DIR"),
+		GitCredScopes:  getScopes("GIT_CREDENTIALS_SCOPES"),
+		GitTimeout:     getDuration("GIT_TIMEOUT", 5*time.Minute),
+		GitAllowFile:   getEnv("GIT_ALLOW_FILE_URLS", "false") == "true",
+		GitPoll:        getDuration("GIT_POLL_INTERVAL", 5*time.Minute),
+		BuildWorkers:   getInt("BUILD_WORKERS", 2),
+		BuildTimeout:   getDuration("BUILD_TIMEOUT", 15*time.Minute),
+		BuildRetention: getInt("BUILD_RETENTION", 5),
+
+		UploadMaxSize:   getSize("UPLOAD_MAX_SIZE", 100<<20),
+		ZipMaxEntries:   getInt("ZIP_MAX_ENTRIES", 10000),
+		ZipMaxFileSize:  getSize("ZIP_MAX_FILE_SIZE", 100<<20),
+		ZipMaxTotalSize: getSize("ZIP_MAX_TOTAL_SIZE", 1<<30),
+		ZipMaxRatio:     int64(getInt("ZIP_MAX_RATIO", 100)),
+
+		LoginMaxAttempts:   getInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginIPMaxAttempts: getInt("LOGIN_IP_MAX_ATTEMPTS", 50),
+		LoginLockout:       getDuration("LOGIN_LOCKOUT", time.Minute),
+		LoginLockoutMax:    getDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+
+		SMTPAddr:     os.Getenv("SMTP_ADDR"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom:     getEnv("MAIL_FROM", "go-mdbook <noreply@localhost>"),
+
+		FrontendURL:        getEnv("FRONTEND_URL", "http://localhost:3000"),
+		OIDCIssuer:         os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:       os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:   os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:    getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/auth/oidc/callback"),
+		OIDCScopes:         getList("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		OIDCGroupsClaim:    getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoleMapping:    getMapping("OIDC_ROLE_MAPPING", ","),
+		OIDCDefaultRole:    getEnv("OIDC_DEFAULT_ROLE", "reader"),
+		OIDCAssumeVerified: getEnv("OIDC_ASSUME_EMAIL_VERIFIED", "false") == "true",
+
+		LDAPURL:         os.Getenv("LDAP_URL"),
+		LDAPStartTLS:    getEnv("LDAP_START_TLS", "false") == "true",
+		LDAPBindDN:      os.Getenv("LDAP_BIND_DN"),
+		LDAPSearchBase:  os.Getenv("LDAP_SEARCH_BASE"),
+		LDAPUserFilter:  getEnv("LDAP_USER_FILTER", "(uid={username})"),
+		LDAPEmailAttr:   getEnv("LDAP_EMAIL_ATTR", "mail"),
+		LDAPGroupAttr:   getEnv("LDAP_GROUP_ATTR", "memberOf"),
+		LDAPRoleMapping: getMapping("LDAP_ROLE_MAPPING", ";"),
+		LDAPDefaultRole: getEnv("LDAP_DEFAULT_ROLE", "reader"),
 	}
 }
 
-func (c Config) Context() context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	return ctx
+func (c Config) Dev() bool {
+	return c.AppEnv == "dev"
+}
+
+// Validate rejects settings that are only safe for local development.
+func (c Config) Validate() error {
+	if c.Dev() {
+		return nil
+	}
+	if c.JWTSecret == DefaultJWTSecret {
+		return errors.New("JWT_SECRET is unset; set it or run with APP_ENV=dev")
+	}
+	if len(c.JWTSecret) < MinSecretLength {
+		return fmt.Errorf("JWT_SECRET must be at least %d bytes", MinSecretLength)
+	}
+	if len(c.ContentSecret) < MinSecretLength {
+		return fmt.Errorf("CONTENT_URL_SECRET must be at least %d bytes", MinSecretLength)
+	}
+	return nil
+}
+
+func (c Config) Context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 10*time.Second)
 }
 
 func getEnv(key, def string) string {
@@ -56,3 +208,92 @@ func getDuration(key string, def time.Duration) time.Duration {
 	}
 	return d
 }
+
+func getInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// getSize reads a byte count, optionally with a K, M or G suffix (powers
+// of 1024), such as "512M".
+func getSize(key string, def int64) int64 {
+	n, err := parseSize(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func parseSize(v string) (int64, error) {
+	v = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(v)), "B"), "I")
+	shift := 0
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		}
+	}
+	if shift > 0 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return 0, errors.New("invalid size")
+	}
+	return n << shift, nil
+}
+
+// getList reads a comma or space separated list.
+func getList(key string, def []string) []string {
+	fields := strings.FieldsFunc(os.Getenv(key), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) == 0 {
+		return def
+	}
+	return fields
+}
+
+// getScopes reads name=value lists separated by ";", with the values of a
+// name separated by spaces, e.g.
+// "docs-token=https://github.com/org/;deploy-key=gitlab.example.org".
+func getScopes(key string) map[string][]string {
+	m := map[string][]string{}
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		name, values, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if ok && name != "" {
+			m[name] = append(m[name], strings.Fields(values)...)
+		}
+	}
+	return m
+}
+
+// getMapping reads key=value pairs separated by sep, e.g.
+// "mdbook-admins=admin,writers=editor". Keys may themselves contain "=",
+// as LDAP group DNs do; the value follows the last one.
+func getMapping(key, sep string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), sep) {
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			continue
+		}
+		k, v := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if k != "" && v != "" {
+			m[k] = v
+		}
+	}
+	return m
+}
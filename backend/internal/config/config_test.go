@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	if err := (Config{JWTSecret: DefaultJWTSecret}).Validate(); err == nil {
+		t.Errorf("expected the default secret to be refused outside dev mode")
+	}
+	if err := (Config{AppEnv: "dev", JWTSecret: DefaultJWTSecret}).Validate(); err != nil {
+		t.Errorf("dev mode: %v", err)
+	}
+	if err := (Config{JWTSecret: "change_me", ContentSecret: "change_me"}).Validate(); err == nil {
+		t.Errorf("expected a short secret to be refused outside dev mode")
+	}
+	strong := strings.Repeat("s", MinSecretLength)
+	if err := (Config{JWTSecret: strong, ContentSecret: "short"}).Validate(); err == nil {
+		t.Errorf("expected a short content secret to be refused outside dev mode")
+	}
+	if err := (Config{JWTSecret: strong, ContentSecret: strong}).Validate(); err != nil {
+		t.Errorf("custom secret: %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"0":      0,
+		"1024":   1024,
+		"512K":   512 << 10,
+		"100M":   100 << 20,
+		"100MB":  100 << 20,
+		"100MiB": 100 << 20,
+		"2g":     2 << 30,
+	}
+	for in, want := range cases {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "1T", "ten", "9999999999G"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestGetScopes(t *testing.T) {
+	t.Setenv("GIT_CREDENTIALS_SCOPES", " docs-token=https://github.com/org/ https://gitlab.com/org/ ;deploy-key=gitea.example.org;broken")
+	scopes := getScopes("GIT_CREDENTIALS_SCOPES")
+	if len(scopes) != 2 || len(scopes["docs-token"]) != 2 || scopes["deploy-key"][0] != "gitea.example.org" {
+		t.Fatalf("unexpected scopes %v", scopes)
+	}
+}
@@ -11,26 +11,125 @@ import (
 )
 
 func EnsureIndexes(cfg config.Config, client *mongo.Client) error {
+	ctx, cancel := cfg.Context()
+	defer cancel()
 	users := collection(cfg, client, "users")
-	_, err := users.Indexes().CreateOne(cfg.Context(), mongo.IndexModel{
-		Keys:    bson.D{{Key: "email", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	_, err := users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "oidc_subject", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
 	})
 	if err != nil {
 		return err
 	}
 
 	books := collection(cfg, client, "books")
-	_, err = books.Indexes().CreateOne(cfg.Context(), mongo.IndexModel{
-		Keys:    bson.D{{Key: "slug", Value: 1}},
+	_, err = books.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "poll.next_at", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"git.poll": true}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	builds := collection(cfg, client, "builds")
+	_, err = builds.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "book_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	buildLogs := collection(cfg, client, "build_logs")
+	_, err = buildLogs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "build_id", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	revisions := collection(cfg, client, "revisions")
+	_, err = revisions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "book_id", Value: 1}, {Key: "number", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	})
+	if err != nil {
+		return err
+	}
+
+	sessions := collection(cfg, client, "sessions")
+	_, err = sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	invites := collection(cfg, client, "invites")
+	_, err = invites.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	resets := collection(cfg, client, "password_resets")
+	_, err = resets.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	groups := collection(cfg, client, "groups")
+	_, err = groups.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "member_ids", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	apiTokens := collection(cfg, client, "api_tokens")
+	_, err = apiTokens.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	attempts := collection(cfg, client, "login_attempts")
+	_, err = attempts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	auditEvents := collection(cfg, client, "audit_events")
+	_, err = auditEvents.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}, {Key: "time", Value: -1}}},
+	})
 	return err
 }
 
 func EnsureAdmin(cfg config.Config, client *mongo.Client) error {
+	ctx, cancel := cfg.Context()
+	defer cancel()
 	users := collection(cfg, client, "users")
-	count, err := users.CountDocuments(cfg.Context(), bson.M{"email": cfg.AdminEmail})
+	count, err := users.CountDocuments(ctx, bson.M{"email": cfg.AdminEmail})
 	if err != nil {
 		return err
 	}
@@ -43,7 +142,7 @@ func EnsureAdmin(cfg config.Config, client *mongo.Client) error {
 		return err
 	}
 
-	_, err = users.InsertOne(cfg.Context(), models.User{
+	_, err = users.InsertOne(ctx, models.User{
 		Email:        cfg.AdminEmail,
 		PasswordHash: hash,
 		Role:         "admin",
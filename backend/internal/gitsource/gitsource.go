@@ -0,0 +1,402 @@
+package gitsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+)
+
+var (
+	// ErrInvalidSource wraps every problem with a GitSource itself, as
+	// opposed to failures talking to the repository.
+	ErrInvalidSource  = errors.New("invalid git source")
+	ErrSubdirNotFound = errors.New("subdirectory not found in commit")
+
+	shaPattern     = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	scpPattern     = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/-]`)
+	credRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// remoteHeadTimeout bounds RemoteHead, which only lists refs and should
+// not take as long as a sync may.
+const remoteHeadTimeout = time.Minute
+
+// Error is a failed git command, with what git printed on stderr.
+type Error struct {
+	Op     string
+	Stderr string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("git %s: %s", e.Op, e.Stderr)
+	}
+	return fmt.Sprintf("git %s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSource, fmt.Sprintf(format, args...))
+}
+
+// Validate checks a source before anything is run with it. Local paths and
+// file:// URLs are only accepted with GIT_ALLOW_FILE_URLS, since they let
+// whoever configures a book read repositories on the server. Credentials
+// are only sent over https or ssh, and only to the URLs GIT_CREDENTIALS_SCOPES
+// binds them to, so they cannot be pointed at another server.
+func Validate(src models.GitSource, cfg config.Config) error {
+	if err := validateURL(src.URL, cfg.GitAllowFile); err != nil {
+		return err
+	}
+	if err := validateRef(src.Ref); err != nil {
+		return err
+	}
+	if _, err := cleanSubdir(src.Subdir); err != nil {
+		return err
+	}
+	if src.CredentialsRef == "" {
+		return nil
+	}
+	if !credRefPattern.MatchString(src.CredentialsRef) {
+		return invalid("credentials reference may only contain letters, digits, '.', '_' and '-'")
+	}
+	target, ok := parseRemote(src.URL)
+	if !ok || (target.scheme != "https" && target.scheme != "ssh") {
+		return invalid("credentials are only sent over https or ssh")
+	}
+	for _, scope := range cfg.GitCredScopes[src.CredentialsRef] {
+		if target.within(scope) {
+			return nil
+		}
+	}
+	return invalid("credentials %q are not allowed for %s", src.CredentialsRef, src.URL)
+}
+
+// remote is a repository URL reduced to what credentials are bound to.
+type remote struct {
+	scheme, host, path string
+}
+
+// parseRemote reads URLs and scp-like ssh addresses.
+func parseRemote(raw string) (remote, bool) {
+	var r remote
+	switch {
+	case strings.Contains(raw, "://"):
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return remote{}, false
+		}
+		r = remote{scheme: u.Scheme, host: u.Host, path: u.Path}
+	case scpPattern.MatchString(raw):
+		host, p, _ := strings.Cut(raw[strings.Index(raw, "@")+1:], ":")
+		r = remote{scheme: "ssh", host: host, path: "/" + p}
+	default:
+		return remote{}, false
+	}
+	r.host = strings.ToLower(r.host)
+	r.path = strings.TrimSuffix(strings.TrimSuffix(path.Clean("/"+r.path), "/"), ".git")
+	return r, true
+}
+
+// within reports whether r is covered by scope: a host name, which covers
+// https and ssh URLs on it, or a URL whose path is a prefix of r's at a
+// "/" boundary.
+func (r remote) within(scope string) bool {
+	if !strings.ContainsAny(scope, ":/") {
+		return r.host == strings.ToLower(scope)
+	}
+	s, ok := parseRemote(scope)
+	if !ok || s.scheme != r.scheme || s.host != r.host {
+		return false
+	}
+	return s.path == "" || r.path == s.path || strings.HasPrefix(r.path, s.path+"/")
+}
+
+func validateURL(raw string, allowFile bool) error {
+	switch {
+	case raw == "":
+		return invalid("url required")
+	case strings.HasPrefix(raw, "-"), strings.ContainsAny(raw, " \t\r\n"):
+		return invalid("malformed url")
+	case strings.Contains(raw, "::"):
+		return invalid("transport helpers are not supported")
+	}
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return invalid("malformed url")
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return invalid("put credentials in a credentials reference, not the url")
+		}
+		switch u.Scheme {
+		case "https", "http", "ssh", "git":
+			return nil
+		case "file":
+			if allowFile {
+				return nil
+			}
+		}
+		return invalid("unsupported url scheme %q", u.Scheme)
+	}
+	if scpPattern.MatchString(raw) {
+		return nil
+	}
+	if allowFile && filepath.IsAbs(raw) {
+		return nil
+	}
+	return invalid("unsupported url")
+}
+
+func validateRef(ref string) error {
+	if ref == "" || shaPattern.MatchString(ref) {
+		return nil
+	}
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/") ||
+		strings.HasSuffix(ref, ".lock") || strings.Contains(ref, "..") || strings.Contains(ref, "@{") ||
+		strings.Contains(ref, "//") {
+		return invalid("malformed ref %q", ref)
+	}
+	for _, r := range ref {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return invalid("malformed ref %q", ref)
+		}
+	}
+	return nil
+}
+
+// cleanSubdir returns the subdirectory as a path inside the repository, or
+// "" for its root.
+func cleanSubdir(subdir string) (string, error) {
+	if subdir == "" {
+		return "", nil
+	}
+	clean := path.Clean(strings.ReplaceAll(subdir, "\\", "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", invalid("subdirectory must be inside the repository")
+	}
+	if clean == "." {
+		return "", nil
+	}
+	return clean, nil
+}
+
+// Fetcher exports commits of book repositories. It keeps a bare cache
+// repository per book under GIT_CACHE_DIR so later syncs only transfer
+// what changed.
+type Fetcher struct {
+	cfg config.Config
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func NewFetcher(cfg config.Config) *Fetcher {
+	return &Fetcher{cfg: cfg, locks: map[string]*sync.Mutex{}}
+}
+
+func (f *Fetcher) lock(key string) func() {
+	f.mu.Lock()
+	l, ok := f.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		f.locks[key] = l
+	}
+	f.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// Export fetches src.Ref into the cache for key and writes the tree of the
+// fetched commit, limited to src.Subdir, as a zip to dst. It returns the
+// commit SHA.
+func (f *Fetcher) Export(ctx context.Context, key string, src models.GitSource, dst string) (string, error) {
+	if err := Validate(src, f.cfg); err != nil {
+		return "", err
+	}
+	subdir, _ := cleanSubdir(src.Subdir)
+	env, err := f.credentials(src.CredentialsRef)
+	if err != nil {
+		return "", err
+	}
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if f.cfg.GitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.cfg.GitTimeout)
+		defer cancel()
+	}
+
+	unlock := f.lock(key)
+	defer unlock()
+
+	repo := filepath.Join(f.cfg.GitCacheDir, key+".git")
+	if _, err := os.Stat(filepath.Join(repo, "HEAD")); err != nil {
+		if err := os.MkdirAll(repo, 0o755); err != nil {
+			return "", err
+		}
+		if _, err := f.git(ctx, "init", nil, "init", "--bare", "--quiet", repo); err != nil {
+			return "", err
+		}
+	}
+	if _, err := f.git(ctx, "fetch", env, "-C", repo, "fetch", "--quiet", "--no-tags", "--depth=1", "--end-of-options", src.URL, ref); err != nil {
+		return "", err
+	}
+	out, err := f.git(ctx, "rev-parse", nil, "-C", repo, "rev-parse", "--verify", "--end-of-options", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+	sha := strings.TrimSpace(string(out))
+
+	tree := sha
+	if subdir != "" {
+		tree = sha + ":" + subdir
+		out, err := f.git(ctx, "cat-file", nil, "-C", repo, "cat-file", "-t", tree)
+		if err != nil || strings.TrimSpace(string(out)) != "tree" {
+			return "", fmt.Errorf("%w: %s", ErrSubdirNotFound, subdir)
+		}
+	}
+	if _, err := f.git(ctx, "archive", nil, "-C", repo, "archive", "--format=zip", "-o", dst, tree); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// RemoteHead returns the commit src.Ref points to on the remote without
+// fetching anything. Short names resolve in the order git fetch uses, and
+// annotated tags are peeled to their commit, so the result compares equal
+// to what Export would return.
+func (f *Fetcher) RemoteHead(ctx context.Context, src models.GitSource) (string, error) {
+	if err := Validate(src, f.cfg); err != nil {
+		return "", err
+	}
+	if shaPattern.MatchString(src.Ref) {
+		return src.Ref, nil
+	}
+	env, err := f.credentials(src.CredentialsRef)
+	if err != nil {
+		return "", err
+	}
+	timeout := remoteHeadTimeout
+	if f.cfg.GitTimeout > 0 && f.cfg.GitTimeout < timeout {
+		timeout = f.cfg.GitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	candidates := []string{"HEAD"}
+	if src.Ref != "" {
+		candidates = []string{src.Ref, "refs/" + src.Ref, "refs/tags/" + src.Ref, "refs/heads/" + src.Ref}
+	}
+	args := []string{"ls-remote", "--end-of-options", src.URL}
+	for _, name := range candidates {
+		args = append(args, name, name+"^{}")
+	}
+	out, err := f.git(ctx, "ls-remote", env, args...)
+	if err != nil {
+		return "", err
+	}
+	// ls-remote matches patterns against the end of ref names, so only
+	// exact names count.
+	refs := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if sha, name, ok := strings.Cut(strings.TrimSpace(line), "\t"); ok {
+			refs[name] = sha
+		}
+	}
+	for _, name := range candidates {
+		if sha, ok := refs[name+"^{}"]; ok {
+			return sha, nil
+		}
+		if sha, ok := refs[name]; ok {
+			return sha, nil
+		}
+	}
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return "", &Error{Op: "ls-remote", Err: fmt.Errorf("ref %s not found", ref)}
+}
+
+// credentials turns a credentials reference into environment for git. The
+// reference names a file in GIT_CREDENTIALS_DIR holding either an SSH
+// private key or "username:token" (or a bare token) for HTTPS. Secrets go
+// through the environment so they never appear in process arguments.
+func (f *Fetcher) credentials(ref string) ([]string, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	if f.cfg.GitCredsDir == "" {
+		return nil, invalid("credentials reference %q set but GIT_CREDENTIALS_DIR is not configured", ref)
+	}
+	file := filepath.Join(f.cfg.GitCredsDir, ref)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, invalid("credentials %q not found", ref)
+	}
+	if bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		ssh := "ssh -i " + shellQuote(file) + " -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new"
+		return []string{"GIT_SSH_COMMAND=" + ssh}, nil
+	}
+	secret := strings.TrimSpace(string(data))
+	if !strings.Contains(secret, ":") {
+		secret = "git:" + secret
+	}
+	header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(secret))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=" + header,
+	}, nil
+}
+
+func (f *Fetcher) git(ctx context.Context, op string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_ALLOW_PROTOCOL="+f.protocols(),
+	)
+	cmd.Env = append(cmd.Env, env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, &Error{Op: op, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return out, nil
+}
+
+func (f *Fetcher) protocols() string {
+	if f.cfg.GitAllowFile {
+		return "https:http:ssh:git:file"
+	}
+	return "https:http:ssh:git"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-mdbook/internal/builds"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (h *Handler) builds() *mongo.Collection {
+	return h.client.Database(h.cfg.MongoDB).Collection("builds")
+}
+
+type buildRequest struct {
+	Revision int `json:"revision"`
+}
+
+func (h *Handler) BuildBook(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	var req buildRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if req.Revision != 0 {
+		if _, err := h.sources.Get(book.ID, req.Revision); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+			return
+		}
+	}
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+
+	build, err := h.queue.Enqueue(book, userID, req.Revision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue build"})
+		return
+	}
+	h.record(c, "build.create", "build", build.ID.Hex(), map[string]any{"bookId": book.ID.Hex(), "revision": req.Revision})
+	c.JSON(http.StatusAccepted, build)
+}
+
+func (h *Handler) ListBuilds(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(50)
+	cur, err := h.builds().Find(ctx, bson.M{"book_id": book.ID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return
+	}
+	defer cur.Close(ctx)
+	list := []models.Build{}
+	if err := cur.All(ctx, &list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) GetBuild(c *gin.Context) {
+	build, ok := h.buildByID(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, build)
+}
+
+func (h *Handler) CancelBuild(c *gin.Context) {
+	build, ok := h.buildByID(c)
+	if !ok {
+		return
+	}
+	err := h.queue.Cancel(build.ID)
+	if errors.Is(err, builds.ErrNotCancellable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cancel failed"})
+		return
+	}
+	h.record(c, "build.cancel", "build", build.ID.Hex(), map[string]any{"bookId": build.BookID.Hex()})
+	c.JSON(http.StatusAccepted, gin.H{"message": "cancelling"})
+}
+
+type publishRequest struct {
+	BuildID string `json:"buildId"`
+}
+
+func (h *Handler) PublishBook(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	var req publishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	buildID, err := primitive.ObjectIDFromHex(req.BuildID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid build id"})
+		return
+	}
+	build, err := h.findBuild(buildID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "build not found"})
+		return
+	}
+	err = h.queue.Publish(book, build)
+	if errors.Is(err, builds.ErrNotPublishable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "publish failed"})
+		return
+	}
+	h.recordChange(c, "book.publish", "book", book.ID.Hex(),
+		gin.H{"publishedBuildId": book.PublishedBuildID}, gin.H{"publishedBuildId": build.ID})
+	c.JSON(http.StatusOK, gin.H{"message": "published"})
+}
+
+func (h *Handler) UnpublishBook(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	if err := h.queue.Unpublish(book); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unpublish failed"})
+		return
+	}
+	h.recordChange(c, "book.unpublish", "book", book.ID.Hex(),
+		gin.H{"publishedBuildId": book.PublishedBuildID}, gin.H{"publishedBuildId": nil})
+	c.JSON(http.StatusOK, gin.H{"message": "unpublished"})
+}
+
+func (h *Handler) PreviewBuildContent(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	build, ok := h.buildByID(c)
+	if !ok {
+		return
+	}
+	if build.BookID != book.ID || build.OutputDir == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	serveContent(c, build.OutputDir)
+}
+
+func (h *Handler) buildByID(c *gin.Context) (models.Build, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("buildId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return models.Build{}, false
+	}
+	build, err := h.findBuild(objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return models.Build{}, false
+	}
+	return build, true
+}
+
+func (h *Handler) buildLogs() *mongo.Collection {
+	return h.client.Database(h.cfg.MongoDB).Collection("build_logs")
+}
+
+func (h *Handler) BuildLogs(c *gin.Context) {
+	build, ok := h.buildByID(c)
+	if !ok {
+		return
+	}
+	lines, err := h.logLinesAfter(build.ID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return
+	}
+	c.JSON(http.StatusOK, lines)
+}
+
+// StreamBuildLogs tails a build's log as Server-Sent Events. Stored lines
+// are replayed first (resuming after Last-Event-ID when given), then new
+// lines are pushed until the build finishes and an "end" event carrying the
+// final build record is sent.
+func (h *Handler) StreamBuildLogs(c *gin.Context) {
+	build, ok := h.buildByID(c)
+	if !ok {
+		return
+	}
+	lastSeq, _ := strconv.Atoi(c.GetHeader("Last-Event-ID"))
+
+	updates, stop, live := h.queue.Follow(build.ID)
+	defer stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	flush := func() bool {
+		lines, err := h.logLinesAfter(build.ID, lastSeq)
+		if err != nil {
+			return false
+		}
+		for _, line := range lines {
+			c.Render(-1, sse.Event{Id: strconv.Itoa(line.Seq), Event: "log", Data: line})
+			lastSeq = line.Seq
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	if !flush() {
+		return
+	}
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for live {
+		select {
+		case _, open := <-updates:
+			if !flush() {
+				return
+			}
+			live = open
+		case <-heartbeat.C:
+			_, _ = c.Writer.WriteString(": keep-alive\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+
+	if final, err := h.findBuild(build.ID); err == nil {
+		build = final
+	}
+	c.Render(-1, sse.Event{Event: "end", Data: build})
+	c.Writer.Flush()
+}
+
+func (h *Handler) logLinesAfter(buildID primitive.ObjectID, seq int) ([]models.BuildLogLine, error) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cur, err := h.buildLogs().Find(ctx, bson.M{"build_id": buildID, "seq": bson.M{"$gt": seq}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	lines := []models.BuildLogLine{}
+	if err := cur.All(ctx, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (h *Handler) findBuild(id primitive.ObjectID) (models.Build, error) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var build models.Build
+	err := h.builds().FindOne(ctx, bson.M{"_id": id}).Decode(&build)
+	return build, err
+}
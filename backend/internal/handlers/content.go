@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type contentURLRequest struct {
+	BuildID string `json:"buildId"`
+}
+
+// ContentURL mints a short-lived signed URL for a book's rendered content.
+// Browsers cannot attach a bearer token to an iframe and the assets it
+// loads, so the frontend embeds this URL instead.
+func (h *Handler) ContentURL(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	subject := h.subject(c)
+	if !access.CanRead(book, subject) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var req contentURLRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.BuildID != "" {
+		if !subject.CanOnBook(book, access.PermBooksBuild) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if _, err := primitive.ObjectIDFromHex(req.BuildID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid build id"})
+			return
+		}
+	}
+
+	grant := auth.ContentGrant{
+		BookID:    book.ID.Hex(),
+		BuildID:   req.BuildID,
+		UserID:    subject.UserID.Hex(),
+		SessionID: c.GetString("sessionId"),
+		TokenID:   c.GetString("apiTokenId"),
+		ExpiresAt: time.Now().Add(h.cfg.ContentURLTTL),
+	}
+	token := auth.SignContentToken(h.cfg, grant)
+	c.JSON(http.StatusOK, gin.H{"path": "/content/" + token + "/", "expiresAt": grant.ExpiresAt})
+}
+
+// SignedContent serves a book's rendered content to the holder of a link
+// minted by ContentURL. The link only proves who asked for it; access is
+// checked again on every request, so it stops working as soon as the book,
+// the user or the session they minted it with does.
+func (h *Handler) SignedContent(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	grant, err := auth.ParseContentToken(h.cfg, c.Param("token"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired link"})
+		return
+	}
+	bookID, err := primitive.ObjectIDFromHex(grant.BookID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired link"})
+		return
+	}
+	subject, err := h.contentSubject(grant)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired link"})
+		return
+	}
+	var book models.Book
+	if err := h.books().FindOne(ctx, bson.M{"_id": bookID}).Decode(&book); err != nil || !access.CanRead(book, subject) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if grant.BuildID != "" && !subject.CanOnBook(book, access.PermBooksBuild) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+
+	root := book.OutputDir
+	if root == "" {
+		root = book.BuildDir
+	}
+	if grant.BuildID != "" {
+		buildID, _ := primitive.ObjectIDFromHex(grant.BuildID)
+		build, err := h.findBuild(buildID)
+		if err != nil || build.BookID != book.ID || build.OutputDir == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		root = build.OutputDir
+	}
+
+	// The token is part of the URL; keep it out of Referer headers sent to
+	// sites the book links to.
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "private")
+	serveContent(c, root)
+}
+
+// contentSubject resolves who a content link was minted for, provided the
+// session or API token they used is still live.
+func (h *Handler) contentSubject(grant auth.ContentGrant) (access.Subject, error) {
+	userID, err := primitive.ObjectIDFromHex(grant.UserID)
+	if err != nil {
+		return access.Subject{}, auth.ErrInvalidContentToken
+	}
+	var scopes []string
+	switch {
+	case grant.TokenID != "":
+		token, err := h.tokens.Lookup(grant.TokenID)
+		if err != nil || token.UserID != userID {
+			return access.Subject{}, auth.ErrInvalidContentToken
+		}
+		scopes = token.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+	case !h.sessions.Active(grant.SessionID):
+		return access.Subject{}, auth.ErrInvalidContentToken
+	}
+	subject, err := h.resolver.ResolveUser(userID)
+	if err != nil {
+		return access.Subject{}, err
+	}
+	subject.Scopes = scopes
+	return subject, nil
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSignedContentRechecksAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	cfg := config.Config{MongoDB: "test", ContentSecret: "test"}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>Book</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: primitive.NewObjectID(), Email: "reader@example.com", Role: access.RoleReader, Active: true}
+	book := models.Book{ID: primitive.NewObjectID(), Title: "Book", OutputDir: root, Active: true}
+	token := auth.SignContentToken(cfg, auth.ContentGrant{
+		BookID:    book.ID.Hex(),
+		UserID:    user.ID.Hex(),
+		SessionID: primitive.NewObjectID().Hex(),
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+
+	cases := []struct {
+		name   string
+		active bool
+		want   int
+	}{
+		{"active book", true, http.StatusOK},
+		{"deactivated book", false, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		mt.Run(tc.name, func(mt *mtest.T) {
+			book.Active = tc.active
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.sessions", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+				mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, mockDoc(mt, user)),
+				mtest.CreateCursorResponse(0, "test.groups", mtest.FirstBatch),
+				mtest.CreateCursorResponse(0, "test.books", mtest.FirstBatch, mockDoc(mt, book)),
+			)
+			h := mockHandler(mt, cfg)
+			r := gin.New()
+			r.GET("/content/:token/*filepath", h.SignedContent)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/content/"+token+"/", nil))
+			if w.Code != tc.want {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// subject describes the authenticated caller for access decisions.
+func (h *Handler) subject(c *gin.Context) access.Subject {
+	if v, ok := c.Get("subject"); ok {
+		return v.(access.Subject)
+	}
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	return access.Subject{UserID: userID, Role: c.GetString("role")}
+}
+
+func (h *Handler) ListGrants(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	grants := book.Grants
+	if grants == nil {
+		grants = []models.Grant{}
+	}
+	c.JSON(http.StatusOK, gin.H{"restricted": book.Restricted, "grants": grants})
+}
+
+type grantRequest struct {
+	Subject string `json:"subject"`
+	ID      string `json:"id"`
+	Level   string `json:"level"`
+}
+
+func (h *Handler) parseGrant(req grantRequest) (models.Grant, string) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	if req.Subject == "" {
+		req.Subject = models.GrantSubjectUser
+	}
+	if req.Level == "" {
+		req.Level = models.GrantRead
+	}
+	if !access.ValidLevel(req.Level) {
+		return models.Grant{}, "unknown permission level"
+	}
+	id, err := primitive.ObjectIDFromHex(req.ID)
+	if err != nil {
+		return models.Grant{}, "invalid subject id"
+	}
+	var subjects *mongo.Collection
+	switch req.Subject {
+	case models.GrantSubjectUser:
+		subjects = h.users()
+	case models.GrantSubjectGroup:
+		subjects = h.groups()
+	default:
+		return models.Grant{}, "unknown subject type"
+	}
+	count, err := subjects.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil || count == 0 {
+		return models.Grant{}, "subject not found"
+	}
+	return models.Grant{Subject: req.Subject, ID: id, Level: req.Level}, ""
+}
+
+type replaceGrantsRequest struct {
+	Restricted *bool          `json:"restricted"`
+	Grants     []grantRequest `json:"grants"`
+}
+
+// ReplaceGrants sets the complete list of grants of a book.
+func (h *Handler) ReplaceGrants(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	var req replaceGrantsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	grants := []models.Grant{}
+	seen := map[string]bool{}
+	for _, gr := range req.Grants {
+		grant, msg := h.parseGrant(gr)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		key := grant.Subject + ":" + grant.ID.Hex()
+		if seen[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duplicate grant for " + key})
+			return
+		}
+		seen[key] = true
+		grants = append(grants, grant)
+	}
+	update := bson.M{"grants": grants}
+	if req.Restricted != nil {
+		update["restricted"] = *req.Restricted
+	}
+	if _, err := h.books().UpdateByID(ctx, book.ID, bson.M{"$set": update}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	restricted := book.Restricted
+	if req.Restricted != nil {
+		restricted = *req.Restricted
+	}
+	h.recordChange(c, "book.grants_replace", "book", book.ID.Hex(),
+		gin.H{"restricted": book.Restricted, "grants": book.Grants},
+		gin.H{"restricted": restricted, "grants": grants})
+	c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+// AddGrant adds a grant to a book, replacing any existing grant for the
+// same subject.
+func (h *Handler) AddGrant(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	var req grantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	grant, msg := h.parseGrant(req)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	_, err := h.books().UpdateByID(ctx, book.ID, bson.M{"$pull": bson.M{"grants": bson.M{"subject": grant.Subject, "id": grant.ID}}})
+	if err == nil {
+		_, err = h.books().UpdateByID(ctx, book.ID, bson.M{"$push": bson.M{"grants": grant}})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	h.record(c, "book.grant_add", "book", book.ID.Hex(), map[string]any{"grant": grant})
+	c.JSON(http.StatusOK, grant)
+}
+
+func (h *Handler) RemoveGrant(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("subjectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subject id"})
+		return
+	}
+	_, err = h.books().UpdateByID(ctx, book.ID, bson.M{"$pull": bson.M{"grants": bson.M{"subject": c.Param("subject"), "id": id}}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	h.record(c, "book.grant_remove", "book", book.ID.Hex(), map[string]any{"subject": c.Param("subject"), "id": id.Hex()})
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (h *Handler) groups() *mongo.Collection {
+	return h.client.Database(h.cfg.MongoDB).Collection("groups")
+}
+
+func (h *Handler) ListGroups(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	cur, err := h.groups().Find(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return
+	}
+	defer cur.Close(ctx)
+	list := []models.Group{}
+	if err := cur.All(ctx, &list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) GetGroup(c *gin.Context) {
+	group, ok := h.groupByID(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+type createGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Role        string `json:"role"`
+}
+
+func (h *Handler) CreateGroup(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req createGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name required"})
+		return
+	}
+	if req.Role != "" && !access.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+		return
+	}
+	group := models.Group{
+		Name:        req.Name,
+		Description: req.Description,
+		Role:        req.Role,
+		MemberIDs:   []primitive.ObjectID{},
+		CreatedAt:   time.Now(),
+	}
+	res, err := h.groups().InsertOne(ctx, group)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group name already exists"})
+		return
+	}
+	group.ID = res.InsertedID.(primitive.ObjectID)
+	h.recordChange(c, "group.create", "group", group.ID.Hex(), nil, group)
+	c.JSON(http.StatusCreated, group)
+}
+
+type updateGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Role        *string `json:"role"`
+}
+
+func (h *Handler) UpdateGroup(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	group, ok := h.groupByID(c)
+	if !ok {
+		return
+	}
+	var req updateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	update := bson.M{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name required"})
+			return
+		}
+		update["name"] = name
+	}
+	if req.Description != nil {
+		update["description"] = *req.Description
+	}
+	if req.Role != nil {
+		if *req.Role != "" && !access.ValidRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+			return
+		}
+		update["role"] = *req.Role
+	}
+	if len(update) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
+		return
+	}
+	if _, err := h.groups().UpdateByID(ctx, group.ID, bson.M{"$set": update}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "update failed"})
+		return
+	}
+	after := group
+	if name, ok := update["name"].(string); ok {
+		after.Name = name
+	}
+	if req.Description != nil {
+		after.Description = *req.Description
+	}
+	if req.Role != nil {
+		after.Role = *req.Role
+	}
+	h.recordChange(c, "group.update", "group", group.ID.Hex(), group, after)
+	c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+func (h *Handler) DeleteGroup(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	group, ok := h.groupByID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.groups().DeleteOne(ctx, bson.M{"_id": group.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
+		return
+	}
+	_, err := h.books().UpdateMany(ctx,
+		bson.M{"grants.id": group.ID},
+		bson.M{"$pull": bson.M{"grants": bson.M{"subject": models.GrantSubjectGroup, "id": group.ID}}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove book grants"})
+		return
+	}
+	h.recordChange(c, "group.delete", "group", group.ID.Hex(), group, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+type memberRequest struct {
+	UserID string `json:"userId"`
+}
+
+func (h *Handler) AddGroupMember(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	group, ok := h.groupByID(c)
+	if !ok {
+		return
+	}
+	var req memberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	count, err := h.users().CountDocuments(ctx, bson.M{"_id": userID})
+	if err != nil || count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if _, err := h.groups().UpdateByID(ctx, group.ID, bson.M{"$addToSet": bson.M{"member_ids": userID}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	h.record(c, "group.member_add", "group", group.ID.Hex(), map[string]any{"userId": userID.Hex()})
+	c.JSON(http.StatusOK, gin.H{"message": "added"})
+}
+
+func (h *Handler) RemoveGroupMember(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	group, ok := h.groupByID(c)
+	if !ok {
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	if _, err := h.groups().UpdateByID(ctx, group.ID, bson.M{"$pull": bson.M{"member_ids": userID}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	h.record(c, "group.member_remove", "group", group.ID.Hex(), map[string]any{"userId": userID.Hex()})
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
+
+func (h *Handler) groupByID(c *gin.Context) (models.Group, bool) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(c.Param("groupId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return models.Group{}, false
+	}
+	var group models.Group
+	if err := h.groups().FindOne(ctx, bson.M{"_id": objID}).Decode(&group); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return models.Group{}, false
+	}
+	return group, true
+}
@@ -2,15 +2,27 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/apitokens"
+	"go-mdbook/internal/audit"
 	"go-mdbook/internal/auth"
+	"go-mdbook/internal/builds"
 	"go-mdbook/internal/config"
+	"go-mdbook/internal/gitsource"
+	"go-mdbook/internal/lockout"
+	"go-mdbook/internal/mail"
 	"go-mdbook/internal/models"
 	"go-mdbook/internal/services"
+	"go-mdbook/internal/sessions"
+	"go-mdbook/internal/settings"
+	"go-mdbook/internal/sources"
+	"go-mdbook/internal/sso"
 	"go-mdbook/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,12 +32,44 @@ import (
 )
 
 type Handler struct {
-	cfg    config.Config
-	client *mongo.Client
+	cfg      config.Config
+	client   *mongo.Client
+	queue    *builds.Queue
+	sources  *sources.Store
+	sessions *sessions.Store
+	tokens   *apitokens.Store
+	keys     *auth.KeySet
+	resolver *access.Resolver
+	settings *settings.Store
+	oidc     *sso.Provider
+	guard    *lockout.Guard
+	audit    *audit.Logger
+	mailer   mail.Mailer
+
+	authenticators []auth.Authenticator
 }
 
-func New(cfg config.Config, client *mongo.Client) *Handler {
-	return &Handler{cfg: cfg, client: client}
+func New(cfg config.Config, client *mongo.Client, queue *builds.Queue, store *sources.Store, sess *sessions.Store, tokens *apitokens.Store, resolver *access.Resolver, siteSettings *settings.Store, keys *auth.KeySet) *Handler {
+	h := &Handler{
+		cfg:      cfg,
+		client:   client,
+		queue:    queue,
+		sources:  store,
+		sessions: sess,
+		tokens:   tokens,
+		keys:     keys,
+		resolver: resolver,
+		settings: siteSettings,
+		oidc:     sso.New(cfg),
+		guard:    lockout.NewGuard(cfg, client),
+		audit:    audit.NewLogger(cfg, client),
+		mailer:   mail.New(cfg),
+	}
+	h.authenticators = []auth.Authenticator{auth.PasswordAuthenticator{Lookup: h.passwordHash}}
+	if cfg.LDAPURL != "" {
+		h.authenticators = append(h.authenticators, auth.NewLDAPAuthenticator(cfg))
+	}
+	return h
 }
 
 func (h *Handler) users() *mongo.Collection {
@@ -48,28 +92,32 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := h.users().FindOne(h.cfg.Context(), bson.M{"email": strings.ToLower(req.Email), "active": true}).Decode(&user); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	attempt := h.reserveLogin(c, req.Email)
+	if attempt == nil {
 		return
 	}
-	if !auth.CheckPassword(user.PasswordHash, req.Password) {
+	user, err := h.authenticate(c.Request.Context(), req.Email, req.Password)
+	if err != nil {
+		h.loginFailed(c, req.Email, attempt)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
-	token, err := auth.GenerateToken(h.cfg, user.ID.Hex(), user.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+	if user.TOTPEnabled {
+		_ = h.guard.Release(attempt)
+		h.requireTwoFactor(c, user)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token, "role": user.Role, "email": user.Email})
+	_ = h.guard.Succeed(attempt)
+	h.startSession(c, user)
 }
 
 func (h *Handler) Me(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	userID := c.GetString("userId")
 	objID, _ := primitive.ObjectIDFromHex(userID)
 	var user models.User
-	if err := h.users().FindOne(h.cfg.Context(), bson.M{"_id": objID}).Decode(&user); err != nil {
+	if err := h.users().FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
@@ -77,15 +125,17 @@ func (h *Handler) Me(c *gin.Context) {
 }
 
 func (h *Handler) ListUsers(c *gin.Context) {
-	cur, err := h.users().Find(h.cfg.Context(), bson.M{})
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	cur, err := h.users().Find(ctx, bson.M{})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
 		return
 	}
-	defer cur.Close(h.cfg.Context())
+	defer cur.Close(ctx)
 
 	users := []models.User{}
-	if err := cur.All(h.cfg.Context(), &users); err != nil {
+	if err := cur.All(ctx, &users); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode"})
 		return
 	}
@@ -99,13 +149,19 @@ type createUserRequest struct {
 }
 
 func (h *Handler) CreateUser(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	var req createUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
 	if req.Role == "" {
-		req.Role = "reader"
+		req.Role = access.RoleReader
+	}
+	if !access.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+		return
 	}
 	if req.Email == "" || req.Password == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "email and password required"})
@@ -118,11 +174,13 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		return
 	}
 	user := models.User{Email: strings.ToLower(req.Email), PasswordHash: hash, Role: req.Role, Active: true}
-	_, err = h.users().InsertOne(h.cfg.Context(), user)
+	res, err := h.users().InsertOne(ctx, user)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "email already exists"})
 		return
 	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	h.recordChange(c, "user.create", "user", user.ID.Hex(), nil, user)
 	c.JSON(http.StatusCreated, gin.H{"message": "created"})
 }
 
@@ -132,6 +190,8 @@ type updateUserRequest struct {
 }
 
 func (h *Handler) UpdateUser(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -145,6 +205,10 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 	}
 	update := bson.M{}
 	if req.Role != nil {
+		if !access.ValidRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+			return
+		}
 		update["role"] = *req.Role
 	}
 	if req.Active != nil {
@@ -154,38 +218,77 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
 		return
 	}
-	_, err = h.users().UpdateByID(h.cfg.Context(), objID, bson.M{"$set": update})
-	if err != nil {
+	var before models.User
+	if err := h.users().FindOneAndUpdate(ctx, bson.M{"_id": objID}, bson.M{"$set": update}).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 		return
 	}
+	after := before
+	if req.Role != nil {
+		after.Role = *req.Role
+	}
+	if req.Active != nil {
+		after.Active = *req.Active
+	}
+	h.recordChange(c, "user.update", "user", id, before, after)
+	if (req.Active != nil && !*req.Active) || (req.Role != nil && *req.Role != before.Role) {
+		if err := h.sessions.RevokeUser(objID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
 func (h *Handler) DeleteUser(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	_, err = h.users().DeleteOne(h.cfg.Context(), bson.M{"_id": objID})
-	if err != nil {
+	var before models.User
+	if err := h.users().FindOneAndDelete(ctx, bson.M{"_id": objID}).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
 		return
 	}
+	h.recordChange(c, "user.delete", "user", id, before, nil)
+	if err := h.sessions.RevokeUser(objID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+	if err := h.tokens.RevokeUser(objID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api tokens"})
+		return
+	}
+	if _, err := h.groups().UpdateMany(ctx, bson.M{"member_ids": objID}, bson.M{"$pull": bson.M{"member_ids": objID}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove group memberships"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
 
 func (h *Handler) ListBooks(c *gin.Context) {
-	cur, err := h.books().Find(h.cfg.Context(), bson.M{"active": true})
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	cur, err := h.books().Find(ctx, access.ReadFilter(h.subject(c)))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
 		return
 	}
-	defer cur.Close(h.cfg.Context())
+	defer cur.Close(ctx)
 	books := []models.Book{}
-	if err := cur.All(h.cfg.Context(), &books); err != nil {
+	if err := cur.All(ctx, &books); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode"})
 		return
 	}
@@ -193,6 +296,8 @@ func (h *Handler) ListBooks(c *gin.Context) {
 }
 
 func (h *Handler) GetBook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -200,7 +305,11 @@ func (h *Handler) GetBook(c *gin.Context) {
 		return
 	}
 	var book models.Book
-	if err := h.books().FindOne(h.cfg.Context(), bson.M{"_id": objID, "active": true}).Decode(&book); err != nil {
+	if err := h.books().FindOne(ctx, bson.M{"_id": objID, "active": true}).Decode(&book); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if !access.CanRead(book, h.subject(c)) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
@@ -208,11 +317,14 @@ func (h *Handler) GetBook(c *gin.Context) {
 }
 
 type createBookRequest struct {
-	Title string `json:"title"`
-	Slug  string `json:"slug"`
+	Title string            `json:"title"`
+	Slug  string            `json:"slug"`
+	Git   *models.GitSource `json:"git"`
 }
 
 func (h *Handler) CreateBook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	var req createBookRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
@@ -222,6 +334,16 @@ func (h *Handler) CreateBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "title required"})
 		return
 	}
+	if req.Git != nil {
+		if err := gitsource.Validate(*req.Git, h.cfg); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !h.mayUseCredentials(c, nil, *req.Git) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+	}
 	slug := req.Slug
 	if slug == "" {
 		slug = utils.Slugify(req.Title)
@@ -239,22 +361,42 @@ func (h *Handler) CreateBook(c *gin.Context) {
 		return
 	}
 
-	book := models.Book{Title: req.Title, Slug: slug, SourceDir: sourceDir, BuildDir: buildDir, Active: true}
-	res, err := h.books().InsertOne(h.cfg.Context(), book)
+	book := models.Book{Title: req.Title, Slug: slug, SourceDir: sourceDir, BuildDir: buildDir, Active: true, Git: req.Git}
+	res, err := h.books().InsertOne(ctx, book)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "slug already exists"})
 		return
 	}
 	book.ID = res.InsertedID.(primitive.ObjectID)
+	h.recordChange(c, "book.create", "book", book.ID.Hex(), nil, book)
 	c.JSON(http.StatusCreated, book)
 }
 
 type updateBookRequest struct {
-	Title  *string `json:"title"`
-	Active *bool   `json:"active"`
+	Title      *string `json:"title"`
+	Active     *bool   `json:"active"`
+	Restricted *bool   `json:"restricted"`
+	// Git replaces the Git source; one with an empty URL removes it.
+	Git *models.GitSource `json:"git"`
+}
+
+// mayUseCredentials reports whether the subject may save next in place of
+// current. Choosing server credentials, or pointing a source that uses
+// them at another URL, takes PermGitCredentials: books:update alone would
+// let a maintainer send a token to a server they control.
+func (h *Handler) mayUseCredentials(c *gin.Context, current *models.GitSource, next models.GitSource) bool {
+	if next.CredentialsRef == "" {
+		return true
+	}
+	if current != nil && current.CredentialsRef == next.CredentialsRef && current.URL == next.URL {
+		return true
+	}
+	return h.subject(c).Can(access.PermGitCredentials)
 }
 
 func (h *Handler) UpdateBook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -273,53 +415,115 @@ func (h *Handler) UpdateBook(c *gin.Context) {
 	if req.Active != nil {
 		update["active"] = *req.Active
 	}
-	if len(update) == 0 {
+	if req.Restricted != nil {
+		if !h.subject(c).Can(access.PermBooksGrants) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		update["restricted"] = *req.Restricted
+	}
+	// A changed source makes the next sync import even an already synced
+	// commit, since the ref or subdirectory may differ.
+	unset := bson.M{}
+	if req.Git != nil {
+		unset["git_sha"] = ""
+		unset["poll"] = ""
+		if req.Git.URL == "" {
+			unset["git"] = ""
+		} else if err := gitsource.Validate(*req.Git, h.cfg); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else {
+			var current models.Book
+			if err := h.books().FindOne(ctx, bson.M{"_id": objID}).Decode(&current); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+				return
+			}
+			if !h.mayUseCredentials(c, current.Git, *req.Git) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+			update["git"] = req.Git
+		}
+	}
+	if len(update) == 0 && len(unset) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
 		return
 	}
-	_, err = h.books().UpdateByID(h.cfg.Context(), objID, bson.M{"$set": update})
-	if err != nil {
+	change := bson.M{}
+	if len(update) > 0 {
+		change["$set"] = update
+	}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+	var before models.Book
+	if err := h.books().FindOneAndUpdate(ctx, bson.M{"_id": objID}, change).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 		return
 	}
+	after := before
+	if req.Title != nil {
+		after.Title = *req.Title
+	}
+	if req.Active != nil {
+		after.Active = *req.Active
+	}
+	if req.Restricted != nil {
+		after.Restricted = *req.Restricted
+	}
+	if req.Git != nil {
+		after.GitSHA = ""
+		after.Git = req.Git
+		if req.Git.URL == "" {
+			after.Git = nil
+		}
+	}
+	h.recordChange(c, "book.update", "book", id, before, after)
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
 func (h *Handler) DeleteBook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	_, err = h.books().DeleteOne(h.cfg.Context(), bson.M{"_id": objID})
-	if err != nil {
+	var before models.Book
+	if err := h.books().FindOneAndDelete(ctx, bson.M{"_id": objID}).Decode(&before); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
 		return
 	}
+	h.recordChange(c, "book.delete", "book", id, before, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
 
-func (h *Handler) BuildBook(c *gin.Context) {
+func (h *Handler) UploadBook(c *gin.Context) {
 	book, ok := h.bookByID(c)
 	if !ok {
 		return
 	}
 
-	if err := services.BuildBook(book.SourceDir, book.BuildDir); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if h.cfg.UploadMaxSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.cfg.UploadMaxSize)
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "built"})
-}
-
-func (h *Handler) UploadBook(c *gin.Context) {
-	book, ok := h.bookByID(c)
-	if !ok {
+	file, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit)})
 		return
 	}
-
-	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing file"})
 		return
@@ -329,40 +533,43 @@ func (h *Handler) UploadBook(c *gin.Context) {
 		return
 	}
 
-	tmpDir := os.TempDir()
-	tmpPath := filepath.Join(tmpDir, file.Filename)
-	if err := c.SaveUploadedFile(file, tmpPath); err != nil {
+	tmp, err := os.CreateTemp("", "mdbook-upload-*.zip")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save upload"})
 		return
 	}
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
 	defer func() {
 		_ = os.Remove(tmpPath)
 	}()
-
-	if book.SourceDir == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "missing source directory"})
+	if err := c.SaveUploadedFile(file, tmpPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save upload"})
 		return
 	}
 
-	if err := os.RemoveAll(book.SourceDir); err != nil && !errors.Is(err, os.ErrNotExist) {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear source directory"})
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	rev, err := h.sources.Upload(book, tmpPath, file.Filename, userID)
+	var limitErr *services.LimitError
+	if errors.As(err, &limitErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": limitErr.Error()})
 		return
 	}
-	if err := os.MkdirAll(book.SourceDir, 0o755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to recreate source directory"})
+	var archiveErr *sources.ArchiveError
+	if errors.As(err, &archiveErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": archiveErr.Err.Error()})
 		return
 	}
-	if err := os.RemoveAll(book.BuildDir); err != nil && !errors.Is(err, os.ErrNotExist) {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear build directory"})
+	if projectErrorResponse(c, err) {
 		return
 	}
-
-	if err := services.ExtractZip(tmpPath, book.SourceDir); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store upload"})
 		return
 	}
+	h.record(c, "book.upload", "book", book.ID.Hex(), map[string]any{"revision": rev.Number, "filename": file.Filename})
 
-	c.JSON(http.StatusOK, gin.H{"message": "uploaded"})
+	c.JSON(http.StatusOK, gin.H{"message": "uploaded", "revision": rev})
 }
 
 func (h *Handler) BookContent(c *gin.Context) {
@@ -370,15 +577,27 @@ func (h *Handler) BookContent(c *gin.Context) {
 	if !ok {
 		return
 	}
+	if !access.CanRead(book, h.subject(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	root := book.OutputDir
+	if root == "" {
+		root = book.BuildDir
+	}
+	serveContent(c, root)
+}
 
+func serveContent(c *gin.Context, root string) {
 	filepathParam := strings.TrimPrefix(c.Param("filepath"), "/")
 	if filepathParam == "" {
 		filepathParam = "index.html"
 	}
 	cleanPath := filepath.Clean(filepathParam)
-	full := filepath.Join(book.BuildDir, cleanPath)
-	buildRoot := filepath.Clean(book.BuildDir) + string(os.PathSeparator)
-	if !strings.HasPrefix(filepath.Clean(full), buildRoot) && filepath.Clean(full) != filepath.Clean(book.BuildDir) {
+	full := filepath.Join(root, cleanPath)
+	buildRoot := filepath.Clean(root) + string(os.PathSeparator)
+	if !strings.HasPrefix(filepath.Clean(full), buildRoot) && filepath.Clean(full) != filepath.Clean(root) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
 		return
 	}
@@ -386,6 +605,8 @@ func (h *Handler) BookContent(c *gin.Context) {
 }
 
 func (h *Handler) bookByID(c *gin.Context) (models.Book, bool) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -393,7 +614,7 @@ func (h *Handler) bookByID(c *gin.Context) (models.Book, bool) {
 		return models.Book{}, false
 	}
 	var book models.Book
-	if err := h.books().FindOne(h.cfg.Context(), bson.M{"_id": objID}).Decode(&book); err != nil {
+	if err := h.books().FindOne(ctx, bson.M{"_id": objID}).Decode(&book); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return models.Book{}, false
 	}
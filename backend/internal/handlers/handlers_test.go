@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+	"go-mdbook/internal/sessions"
+	"go-mdbook/internal/settings"
+	"go-mdbook/internal/sources"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// mockHandler builds a Handler on a mocked deployment, which answers the
+// handler's queries in order with the responses the test adds.
+func mockHandler(mt *mtest.T, cfg config.Config) *Handler {
+	return &Handler{
+		cfg:      cfg,
+		client:   mt.Client,
+		sources:  sources.NewStore(cfg, mt.Client),
+		sessions: sessions.NewStore(cfg, mt.Client),
+		resolver: access.NewResolver(cfg, mt.Client, settings.NewStore(cfg, mt.Client)),
+	}
+}
+
+// mockDoc converts a model to the form mock responses are built from.
+func mockDoc(mt *mtest.T, v interface{}) bson.D {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		mt.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		mt.Fatal(err)
+	}
+	return doc
+}
+
+func zipBytes(t testing.TB, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func uploadRequest(t testing.TB, filename string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/books/"+primitive.NewObjectID().Hex()+"/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestUploadBookRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	cfg := config.Config{MongoDB: "test", UploadMaxSize: 64 << 10, ZipMaxEntries: 10}
+	cases := []struct {
+		name string
+		data []byte
+		want int
+		msg  string
+	}{
+		{"oversized body", bytes.Repeat([]byte("x"), 128<<10), http.StatusRequestEntityTooLarge, "upload exceeds"},
+		{"too many entries", zipBytes(t, map[string]string{
+			"a.md": "", "b.md": "", "c.md": "", "d.md": "", "e.md": "", "f.md": "",
+			"g.md": "", "h.md": "", "i.md": "", "j.md": "", "k.md": "",
+		}), http.StatusRequestEntityTooLarge, "entry count"},
+		{"bad archive", []byte("not a zip"), http.StatusBadRequest, "zip"},
+		{"not a project", zipBytes(t, map[string]string{"README.md": ""}), http.StatusUnprocessableEntity, "invalid mdBook project"},
+	}
+	for _, tc := range cases {
+		mt.Run(tc.name, func(mt *mtest.T) {
+			book := models.Book{ID: primitive.NewObjectID(), SourceDir: filepath.Join(mt.TempDir(), "book"), Active: true}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.books", mtest.FirstBatch, mockDoc(mt, book)))
+			h := mockHandler(mt, cfg)
+			r := gin.New()
+			r.POST("/books/:id/upload", h.UploadBook)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, uploadRequest(mt, "book.zip", tc.data))
+			if w.Code != tc.want || !strings.Contains(w.Body.String(), tc.msg) {
+				mt.Fatalf("got %d %s, want %d with %q", w.Code, w.Body.String(), tc.want, tc.msg)
+			}
+		})
+	}
+}
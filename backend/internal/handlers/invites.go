@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/mail"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (h *Handler) invites() *mongo.Collection {
+	return h.client.Database(h.cfg.MongoDB).Collection("invites")
+}
+
+type createInviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// CreateInvite issues a one-time token with which the invitee creates their
+// own account and password. The token is emailed when a mailer is
+// configured and always returned, so the admin can pass it on otherwise.
+// A new invite replaces any pending one for the same email.
+func (h *Handler) CreateInvite(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req createInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = access.RoleReader
+	}
+	if !access.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+		return
+	}
+	count, err := h.users().CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "a user with this email already exists"})
+		return
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	if _, err := h.invites().DeleteMany(ctx, bson.M{"email": email, "accepted_at": nil}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+	createdBy, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	now := time.Now()
+	invite := models.Invite{
+		Email:     email,
+		Role:      req.Role,
+		TokenHash: auth.HashToken(token),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.InviteTTL),
+	}
+	res, err := h.invites().InsertOne(ctx, invite)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+	invite.ID = res.InsertedID.(primitive.ObjectID)
+
+	link := h.inviteLink(token)
+	sent := false
+	if h.mailer != nil {
+		if err := h.mailer.Send(inviteMessage(h.cfg.SiteName, invite, link)); err != nil {
+			log.Printf("send invite to %s: %v", invite.Email, err)
+		} else {
+			sent = true
+		}
+	}
+	h.record(c, "invite.create", "invite", invite.ID.Hex(), map[string]any{"email": invite.Email, "role": invite.Role, "sent": sent})
+	c.JSON(http.StatusCreated, gin.H{"invite": invite, "token": token, "url": link, "sent": sent})
+}
+
+// inviteLink points at the frontend; the token travels in the fragment so
+// it stays out of server and proxy logs.
+func (h *Handler) inviteLink(token string) string {
+	return strings.TrimRight(h.cfg.FrontendURL, "/") + "/#invite=" + token
+}
+
+func inviteMessage(site string, invite models.Invite, link string) mail.Message {
+	return mail.Message{
+		To:      invite.Email,
+		Subject: "You're invited to " + site,
+		Body: "You have been invited to " + site + " as " + invite.Role + ".\n\n" +
+			"Open this link to choose your password and sign in:\n\n" + link + "\n\n" +
+			"The link works once and expires on " + invite.ExpiresAt.UTC().Format(time.RFC1123) + ".\n",
+	}
+}
+
+// ListInvites returns the invites that can still be accepted.
+func (h *Handler) ListInvites(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cur, err := h.invites().Find(ctx, bson.M{"accepted_at": nil, "expires_at": bson.M{"$gt": time.Now()}}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return
+	}
+	defer cur.Close(ctx)
+	list := []models.Invite{}
+	if err := cur.All(ctx, &list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) RevokeInvite(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	id, err := primitive.ObjectIDFromHex(c.Param("inviteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var invite models.Invite
+	err = h.invites().FindOneAndDelete(ctx, bson.M{"_id": id, "accepted_at": nil}).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke failed"})
+		return
+	}
+	h.record(c, "invite.revoke", "invite", invite.ID.Hex(), map[string]any{"email": invite.Email})
+	c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
+
+type acceptInviteRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// AcceptInvite creates the invited account with the chosen password and
+// signs the new user in. The invite is claimed before the account is
+// created, so two requests cannot both use it, and handed back if creating
+// the account fails.
+func (h *Handler) AcceptInvite(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req acceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	var invite models.Invite
+	err := h.invites().FindOneAndUpdate(ctx,
+		bson.M{"token_hash": auth.HashToken(req.Token), "accepted_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"accepted_at": now}},
+	).Decode(&invite)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired invite"})
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		h.releaseInvite(invite.ID, now)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash"})
+		return
+	}
+	user := models.User{Email: invite.Email, PasswordHash: hash, Role: invite.Role, Active: true}
+	res, err := h.users().InsertOne(ctx, user)
+	if err != nil {
+		h.releaseInvite(invite.ID, now)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a user with this email already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
+		return
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	_, _ = h.invites().UpdateByID(ctx, invite.ID, bson.M{"$set": bson.M{"user_id": user.ID}})
+
+	c.Set("userId", user.ID.Hex())
+	h.record(c, "invite.accept", "invite", invite.ID.Hex(), map[string]any{"email": invite.Email})
+	h.recordChange(c, "user.create", "user", user.ID.Hex(), nil, user)
+	h.startSession(c, user)
+}
+
+// releaseInvite undoes the claim AcceptInvite made at claimedAt, so the
+// invite can be used again.
+func (h *Handler) releaseInvite(id primitive.ObjectID, claimedAt time.Time) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	_, err := h.invites().UpdateOne(ctx,
+		bson.M{"_id": id, "accepted_at": claimedAt, "user_id": nil},
+		bson.M{"$unset": bson.M{"accepted_at": ""}},
+	)
+	if err != nil {
+		log.Printf("invite %s: release: %v", id.Hex(), err)
+	}
+}
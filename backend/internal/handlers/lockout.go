@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/lockout"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// reserveLogin reserves a login attempt for the account and the client IP.
+// While either is locked out it answers 429 and returns nil.
+func (h *Handler) reserveLogin(c *gin.Context, username string) *lockout.Attempt {
+	attempt, wait, err := h.guard.Reserve(username, c.ClientIP(), time.Now())
+	if err != nil {
+		log.Printf("reserve login attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login unavailable"})
+		return nil
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts, try again later", "retryAfter": seconds})
+		return nil
+	}
+	return attempt
+}
+
+// loginFailed audits any lockout a failed attempt caused.
+func (h *Handler) loginFailed(c *gin.Context, username string, attempt *lockout.Attempt) {
+	ip := c.ClientIP()
+	account, client := attempt.Fail()
+	if account > 0 {
+		h.record(c, "auth.lockout", "account", strings.ToLower(strings.TrimSpace(username)), map[string]any{"lockedFor": account.String()})
+	}
+	if client > 0 {
+		h.record(c, "auth.lockout", "ip", ip, map[string]any{"lockedFor": client.String()})
+	}
+}
+
+// UnlockUser lifts a lockout on a user's account.
+func (h *Handler) UnlockUser(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	unlocked, err := h.guard.Unlock(user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unlock failed"})
+		return
+	}
+	if unlocked {
+		h.record(c, "user.unlock", "user", user.ID.Hex(), map[string]any{"email": user.Email})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "unlocked"})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// authenticate tries each configured authenticator in turn and returns the
+// account signed in to by the first one that accepts the credentials.
+func (h *Handler) authenticate(ctx context.Context, username, password string) (models.User, error) {
+	for _, a := range h.authenticators {
+		identity, err := a.Authenticate(ctx, username, password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			continue
+		}
+		if err != nil {
+			log.Printf("login via %s: %v", a.Name(), err)
+			continue
+		}
+		return h.loginUser(identity)
+	}
+	return models.User{}, auth.ErrInvalidCredentials
+}
+
+func (h *Handler) passwordHash(email string) (string, bool) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var user models.User
+	err := h.users().FindOne(ctx, bson.M{"email": email, "active": true}).Decode(&user)
+	return user.PasswordHash, err == nil
+}
+
+// loginUser finds the account an identity signs in to. Accounts of an
+// external provider are created on first login and follow the role it
+// reports; a provider never signs in to an account owned by another source,
+// so a directory entry cannot take over a local account with the same
+// email.
+func (h *Handler) loginUser(identity auth.Identity) (models.User, error) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var user models.User
+	err := h.users().FindOne(ctx, bson.M{"email": identity.Email}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) && identity.Source != "" {
+		user = models.User{Email: identity.Email, Role: identity.Role, Active: true, AuthSource: identity.Source}
+		res, err := h.users().InsertOne(ctx, user)
+		if err != nil {
+			return models.User{}, err
+		}
+		user.ID = res.InsertedID.(primitive.ObjectID)
+		h.recordProvider("user.create", user.ID.Hex(), nil, user)
+		return user, nil
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if user.AuthSource != identity.Source {
+		log.Printf("login via %q refused for %s account %s", identity.Source, user.AuthSource, user.Email)
+		return models.User{}, auth.ErrInvalidCredentials
+	}
+	if !user.Active {
+		return models.User{}, auth.ErrInvalidCredentials
+	}
+	if identity.Role != "" {
+		if err := h.syncRole(&user, identity.Role); err != nil {
+			return models.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// syncRole applies a role managed by an external provider and ends the
+// user's sessions if it changed.
+func (h *Handler) syncRole(user *models.User, role string) error {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	if user.Role == role {
+		return nil
+	}
+	_, err := h.users().UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	_ = h.sessions.RevokeUser(user.ID)
+	h.recordProvider("user.role_sync", user.ID.Hex(), gin.H{"role": user.Role}, gin.H{"role": role})
+	user.Role = role
+	return nil
+}
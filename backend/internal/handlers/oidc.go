@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/models"
+	"go-mdbook/internal/sso"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	oidcCookie     = "mdbook_oidc"
+	oidcCookiePath = "/api/auth/oidc"
+)
+
+var (
+	errOIDCEmail    = errors.New("identity provider did not supply a verified email")
+	errOIDCInactive = errors.New("account is deactivated")
+	errOIDCExists   = errors.New("an account with this email already exists; ask an administrator to allow single sign-on for it")
+)
+
+// OIDCLogin sends the browser to the identity provider. The login's state,
+// nonce and PKCE verifier ride along in a short-lived cookie scoped to the
+// callback.
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	if !h.oidc.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": sso.ErrNotConfigured.Error()})
+		return
+	}
+	req, err := sso.NewRequest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login error"})
+		return
+	}
+	target, err := h.oidc.AuthURL(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("oidc login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, req.Encode(), 600, oidcCookiePath, "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, target)
+}
+
+// OIDCCallback finishes the login and hands the tokens to the frontend in
+// the URL fragment, which browsers never send to a server. Users with
+// two-factor authentication get the second login step instead, as with
+// passwords.
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	if !h.oidc.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": sso.ErrNotConfigured.Error()})
+		return
+	}
+	value, _ := c.Cookie(oidcCookie)
+	c.SetCookie(oidcCookie, "", -1, oidcCookiePath, "", c.Request.TLS != nil, true)
+	req, ok := sso.ParseRequest(value)
+	if !ok || c.Query("state") != req.State {
+		h.oidcRedirect(c, url.Values{"error": {"invalid login state"}})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		h.oidcRedirect(c, url.Values{"error": {e}})
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), req, c.Query("code"))
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		h.oidcRedirect(c, url.Values{"error": {"sign-in failed"}})
+		return
+	}
+	user, err := h.oidcUser(identity)
+	if errors.Is(err, errOIDCEmail) || errors.Is(err, errOIDCInactive) || errors.Is(err, errOIDCExists) {
+		h.oidcRedirect(c, url.Values{"error": {err.Error()}})
+		return
+	}
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		h.oidcRedirect(c, url.Values{"error": {"sign-in failed"}})
+		return
+	}
+	if user.TOTPEnabled {
+		h.oidcRedirect(c, url.Values{
+			"mfaToken":  {auth.SignMFAToken(h.cfg, user.ID.Hex(), time.Now())},
+			"expiresIn": {strconv.Itoa(int(auth.MFATokenTTL.Seconds()))},
+		})
+		return
+	}
+
+	session, refresh, err := h.sessions.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		h.oidcRedirect(c, url.Values{"error": {"session error"}})
+		return
+	}
+	body, err := h.tokenResponse(user, session, refresh)
+	if err != nil {
+		h.oidcRedirect(c, url.Values{"error": {"token error"}})
+		return
+	}
+	h.oidcRedirect(c, url.Values{
+		"token":             {body["token"].(string)},
+		"refreshToken":      {refresh},
+		"expiresIn":         {strconv.Itoa(body["expiresIn"].(int))},
+		"role":              {body["role"].(string)},
+		"email":             {user.Email},
+		"twoFactorRequired": {strconv.FormatBool(body["twoFactorRequired"].(bool))},
+	})
+}
+
+func (h *Handler) oidcRedirect(c *gin.Context, fragment url.Values) {
+	c.Redirect(http.StatusFound, strings.TrimRight(h.cfg.FrontendURL, "/")+"/#"+fragment.Encode())
+}
+
+// oidcUser finds the account an identity signs in to. Accounts are matched
+// by subject; on first login a new account is created, or a local account
+// with the same email is linked if an admin allowed it. An existing account
+// is never taken over otherwise, like with directory logins. Accounts
+// created through single sign-on follow the role mapping on every login;
+// linked local accounts keep the role they were given.
+func (h *Handler) oidcUser(identity sso.Identity) (models.User, error) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var user models.User
+	err := h.users().FindOne(ctx, bson.M{"oidc_subject": identity.Subject}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		user, err = h.linkOIDCUser(identity)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if !user.Active {
+		return models.User{}, errOIDCInactive
+	}
+
+	if user.AuthSource == models.AuthSourceOIDC {
+		if err := h.syncRole(&user, h.oidc.Role(identity.Groups)); err != nil {
+			return models.User{}, err
+		}
+	}
+	return user, nil
+}
+
+func (h *Handler) linkOIDCUser(identity sso.Identity) (models.User, error) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, errOIDCEmail
+	}
+	email := strings.ToLower(identity.Email)
+
+	var user models.User
+	err := h.users().FindOneAndUpdate(ctx,
+		bson.M{"email": email, "auth_source": bson.M{"$exists": false}, "oidc_subject": bson.M{"$exists": false}, "oidc_link_allowed": true},
+		bson.M{"$set": bson.M{"oidc_subject": identity.Subject}, "$unset": bson.M{"oidc_link_allowed": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		if err == nil {
+			h.recordProvider("user.oidc_link", user.ID.Hex(), nil, nil)
+		}
+		return user, err
+	}
+	count, err := h.users().CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return models.User{}, err
+	}
+	if count > 0 {
+		log.Printf("oidc login refused for existing account %s", email)
+		return models.User{}, errOIDCExists
+	}
+
+	user = models.User{
+		Email:       email,
+		Role:        h.oidc.Role(identity.Groups),
+		Active:      true,
+		AuthSource:  models.AuthSourceOIDC,
+		OIDCSubject: identity.Subject,
+	}
+	res, err := h.users().InsertOne(ctx, user)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	h.recordProvider("user.create", user.ID.Hex(), nil, user)
+	return user, nil
+}
+
+// AllowOIDCLink lets the next single sign-on with the email of a local
+// account link to it. Accounts of other sources cannot be linked.
+func (h *Handler) AllowOIDCLink(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	user, ok := h.localUser(c)
+	if !ok {
+		return
+	}
+	if user.OIDCSubject != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "account is already linked"})
+		return
+	}
+	_, err := h.users().UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"oidc_link_allowed": true}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update"})
+		return
+	}
+	h.record(c, "user.oidc_link_allow", "user", user.ID.Hex(), map[string]any{"email": user.Email})
+	c.JSON(http.StatusOK, gin.H{"message": "single sign-on link allowed"})
+}
+
+// UnlinkOIDC detaches a local account from its single sign-on identity and
+// withdraws a pending link.
+func (h *Handler) UnlinkOIDC(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	user, ok := h.localUser(c)
+	if !ok {
+		return
+	}
+	_, err := h.users().UpdateByID(ctx, user.ID, bson.M{"$unset": bson.M{"oidc_subject": "", "oidc_link_allowed": ""}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update"})
+		return
+	}
+	_ = h.sessions.RevokeUser(user.ID)
+	h.record(c, "user.oidc_unlink", "user", user.ID.Hex(), map[string]any{"email": user.Email})
+	c.JSON(http.StatusOK, gin.H{"message": "single sign-on unlinked"})
+}
+
+func (h *Handler) localUser(c *gin.Context) (models.User, bool) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return models.User{}, false
+	}
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return models.User{}, false
+	}
+	if user.AuthSource != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "account is managed by " + user.AuthSource})
+		return models.User{}, false
+	}
+	return user, true
+}
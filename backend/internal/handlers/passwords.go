@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (h *Handler) passwordResets() *mongo.Collection {
+	return h.client.Database(h.cfg.MongoDB).Collection("password_resets")
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ChangePassword lets users replace their own password. Every session is
+// revoked, and the caller gets a fresh one so they stay logged in. The
+// current password is checked under the login lockout.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	attempt := h.reserveLogin(c, user.Email)
+	if attempt == nil {
+		return
+	}
+	if !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		h.loginFailed(c, user.Email, attempt)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	}
+	_ = h.guard.Succeed(attempt)
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.setPassword(user.ID, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+	h.record(c, "user.password_change", "user", user.ID.Hex(), nil)
+	h.startSession(c, user)
+}
+
+// ResetPassword issues a one-time token an admin hands to a user who lost
+// their password. Earlier unused tokens for the user stop working.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	count, err := h.users().CountDocuments(ctx, bson.M{"_id": objID})
+	if err != nil || count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	now := time.Now()
+	_, err = h.passwordResets().UpdateMany(ctx,
+		bson.M{"user_id": objID, "used_at": nil},
+		bson.M{"$set": bson.M{"expires_at": now}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reset"})
+		return
+	}
+	createdBy, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	reset := models.PasswordReset{
+		UserID:    objID,
+		TokenHash: auth.HashToken(token),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.ResetTokenTTL),
+	}
+	if _, err := h.passwordResets().InsertOne(ctx, reset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reset"})
+		return
+	}
+	h.record(c, "user.password_reset", "user", objID.Hex(), map[string]any{"expiresAt": reset.ExpiresAt})
+	c.JSON(http.StatusCreated, gin.H{"token": token, "expiresAt": reset.ExpiresAt})
+}
+
+type redeemResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) RedeemReset(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req redeemResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	var reset models.PasswordReset
+	err := h.passwordResets().FindOneAndUpdate(ctx,
+		bson.M{"token_hash": auth.HashToken(req.Token), "used_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&reset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+	if err := h.setPassword(reset.UserID, req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	h.record(c, "user.password_reset_redeem", "user", reset.UserID.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
+// setPassword stores a new password and revokes every session of the user.
+func (h *Handler) setPassword(userID primitive.ObjectID, password string) error {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := h.users().UpdateByID(ctx, userID, bson.M{"$set": bson.M{"password_hash": hash}}); err != nil {
+		return err
+	}
+	return h.sessions.RevokeUser(userID)
+}
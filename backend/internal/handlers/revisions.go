@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-mdbook/internal/gitsource"
+	"go-mdbook/internal/services"
+	"go-mdbook/internal/sources"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (h *Handler) ListRevisions(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	list, err := h.sources.List(book.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"activeRevision": book.ActiveRevision, "revisions": list})
+}
+
+// SyncBook imports the book's Git source at its configured ref as a new
+// revision, unless that commit is already active.
+func (h *Handler) SyncBook(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	rev, changed, err := h.sources.Sync(c.Request.Context(), book, userID)
+	if !h.syncOK(c, err) {
+		return
+	}
+	if changed {
+		h.record(c, "book.sync", "book", book.ID.Hex(), map[string]any{"revision": rev.Number, "commit": rev.Commit})
+	}
+	c.JSON(http.StatusOK, gin.H{"changed": changed, "commit": rev.Commit, "revision": rev})
+}
+
+// syncOK reports whether a sync succeeded and otherwise answers with the
+// status matching what went wrong.
+func (h *Handler) syncOK(c *gin.Context, err error) bool {
+	var archiveErr *sources.ArchiveError
+	var projectErr *services.ProjectError
+	var gitErr *gitsource.Error
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sources.ErrNoGitSource):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gitsource.ErrInvalidSource), errors.Is(err, gitsource.ErrSubdirNotFound):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.As(err, &archiveErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": archiveErr.Err.Error()})
+	case errors.As(err, &projectErr):
+		projectErrorResponse(c, err)
+	case errors.As(err, &gitErr):
+		c.JSON(http.StatusBadGateway, gin.H{"error": gitErr.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "sync failed"})
+	}
+	return false
+}
+
+// projectErrorResponse answers with the problems when err reports a
+// source that is not a buildable mdBook project.
+func projectErrorResponse(c *gin.Context, err error) bool {
+	var projectErr *services.ProjectError
+	if !errors.As(err, &projectErr) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid mdBook project", "problems": projectErr.Problems})
+	return true
+}
+
+func (h *Handler) ActivateRevision(c *gin.Context) {
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return
+	}
+	rev, err := h.sources.Get(book.ID, number)
+	if errors.Is(err, sources.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load revision"})
+		return
+	}
+	err = h.sources.Activate(book, rev)
+	if projectErrorResponse(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to activate revision"})
+		return
+	}
+	h.recordChange(c, "book.revision_activate", "book", book.ID.Hex(),
+		gin.H{"activeRevision": book.ActiveRevision}, gin.H{"activeRevision": rev.Number})
+	c.JSON(http.StatusOK, gin.H{"message": "activated", "revision": rev})
+}
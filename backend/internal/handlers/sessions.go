@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// startSession opens a session for an authenticated user and responds
+// with its access and refresh tokens.
+func (h *Handler) startSession(c *gin.Context, user models.User) {
+	session, refresh, err := h.sessions.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "session error"})
+		return
+	}
+	h.respondTokens(c, user, session, refresh)
+}
+
+func (h *Handler) respondTokens(c *gin.Context, user models.User, session models.Session, refresh string) {
+	body, err := h.tokenResponse(user, session, refresh)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func (h *Handler) tokenResponse(user models.User, session models.Session, refresh string) (gin.H, error) {
+	token, err := h.keys.GenerateToken(user.ID.Hex(), user.Role, session.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	// Report the effective role so clients show what group membership
+	// unlocks; the token keeps the user's own role and is re-resolved on
+	// every request.
+	role, needsTwoFactor := user.Role, false
+	if subject, err := h.resolver.Resolve(user.ID, user.Role); err == nil {
+		role, needsTwoFactor = subject.Role, subject.NeedsTwoFactor
+	}
+	return gin.H{
+		"token":             token,
+		"refreshToken":      refresh,
+		"expiresIn":         int(h.cfg.TokenTTL.Seconds()),
+		"role":              role,
+		"permissions":       access.Permissions(role),
+		"email":             user.Email,
+		"twoFactorRequired": needsTwoFactor,
+	}, nil
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (h *Handler) Refresh(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	session, refresh, err := h.sessions.Rotate(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": session.UserID, "active": true}).Decode(&user); err != nil {
+		_ = h.sessions.Revoke(session.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	h.respondTokens(c, user, session, refresh)
+}
+
+func (h *Handler) Logout(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	session, err := h.sessions.Lookup(req.RefreshToken)
+	if err == nil {
+		if err := h.sessions.Revoke(session.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "logout failed"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// JWKS publishes the public keys access tokens are signed with, including
+// inactive ones, so tokens signed before a rotation still verify.
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
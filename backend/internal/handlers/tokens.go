@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/apitokens"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type createTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (h *Handler) ListMyTokens(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	h.listTokens(c, &userID)
+}
+
+// CreateToken mints an API token for the caller. The token is returned
+// once; only its hash is kept.
+func (h *Handler) CreateToken(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and scopes required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !access.ValidPermission(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope: " + scope})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future"})
+		return
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	token, secret, err := h.tokens.Create(userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	h.recordChange(c, "token.create", "api_token", token.ID.Hex(), nil, token)
+	c.JSON(http.StatusCreated, gin.H{"token": secret, "apiToken": token})
+}
+
+func (h *Handler) RevokeMyToken(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	h.revokeToken(c, &userID)
+}
+
+// ListTokens lists every user's tokens, or one user's with ?userId=.
+func (h *Handler) ListTokens(c *gin.Context) {
+	if v := c.Query("userId"); v != "" {
+		userID, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid userId"})
+			return
+		}
+		h.listTokens(c, &userID)
+		return
+	}
+	h.listTokens(c, nil)
+}
+
+func (h *Handler) RevokeToken(c *gin.Context) {
+	h.revokeToken(c, nil)
+}
+
+func (h *Handler) listTokens(c *gin.Context, userID *primitive.ObjectID) {
+	list, err := h.tokens.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) revokeToken(c *gin.Context, userID *primitive.ObjectID) {
+	id, err := primitive.ObjectIDFromHex(c.Param("tokenId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	err = h.tokens.Revoke(id, userID)
+	if errors.Is(err, apitokens.ErrTokenNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke failed"})
+		return
+	}
+	h.record(c, "token.revoke", "api_token", id.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
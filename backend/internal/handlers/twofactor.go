@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type twoFactorRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+// requireTwoFactor answers the first login step of a user with two-factor
+// authentication enabled. The session is only started once CompleteTwoFactor
+// receives a valid code for the returned token.
+func (h *Handler) requireTwoFactor(c *gin.Context, user models.User) {
+	c.JSON(http.StatusOK, gin.H{
+		"mfaRequired": true,
+		"mfaToken":    auth.SignMFAToken(h.cfg, user.ID.Hex(), time.Now()),
+		"expiresIn":   int(auth.MFATokenTTL.Seconds()),
+	})
+}
+
+func (h *Handler) CompleteTwoFactor(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req twoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfaToken and code required"})
+		return
+	}
+	userHex, err := auth.ParseMFAToken(h.cfg, req.MFAToken, time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login expired, sign in again"})
+		return
+	}
+	userID, _ := primitive.ObjectIDFromHex(userHex)
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID, "active": true, "totp_enabled": true}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login expired, sign in again"})
+		return
+	}
+	if !h.secondFactorOK(c, user, req.Code) {
+		return
+	}
+	h.startSession(c, user)
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery
+// code. Both are consumed in a single conditional update, so concurrent
+// requests cannot use the same code twice.
+func (h *Handler) checkSecondFactor(user models.User, code string) (bool, error) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	if step, ok := auth.VerifyTOTP(user.TOTPSecret, code, time.Now()); ok {
+		res, err := h.users().UpdateOne(ctx,
+			bson.M{"_id": user.ID, "totp_last_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"totp_last_step": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return res.ModifiedCount == 1, nil
+	}
+	hash := auth.HashToken(auth.NormalizeRecoveryCode(code))
+	res, err := h.users().UpdateOne(ctx,
+		bson.M{"_id": user.ID, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func (h *Handler) currentUser(c *gin.Context) (models.User, bool) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	var user models.User
+	if err := h.users().FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// EnrollTwoFactor starts enrollment with a fresh secret. It only takes
+// effect once VerifyTwoFactor confirms the authenticator app produces
+// matching codes.
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+	if _, err := h.users().UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"totp_pending_secret": secret}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    auth.TOTPURI(h.cfg.TOTPIssuer, user.Email, secret),
+	})
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+// VerifyTwoFactor enables two-factor authentication and returns the
+// recovery codes, which are not shown again.
+func (h *Handler) VerifyTwoFactor(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req codeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code required"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled || user.TOTPPendingSecret == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "no enrollment in progress"})
+		return
+	}
+	step, valid := auth.VerifyTOTP(user.TOTPPendingSecret, req.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	res, err := h.users().UpdateOne(ctx,
+		bson.M{"_id": user.ID, "totp_pending_secret": user.TOTPPendingSecret},
+		bson.M{
+			"$set": bson.M{
+				"totp_enabled":   true,
+				"totp_secret":    user.TOTPPendingSecret,
+				"totp_last_step": step,
+				"recovery_codes": hashes,
+			},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		},
+	)
+	if err != nil || res.ModifiedCount == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+	h.record(c, "user.2fa_enable", "user", user.ID.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a
+// code, so a hijacked session alone cannot remove it.
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req codeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code required"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !h.secondFactorOK(c, user, req.Code) {
+		return
+	}
+	_, err := h.users().UpdateByID(ctx, user.ID, bson.M{
+		"$unset": bson.M{"totp_enabled": "", "totp_secret": "", "totp_last_step": "", "recovery_codes": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+	h.record(c, "user.2fa_disable", "user", user.ID.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes with new ones.
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	var req codeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code required"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !h.secondFactorOK(c, user, req.Code) {
+		return
+	}
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if _, err := h.users().UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"recovery_codes": hashes}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store recovery codes"})
+		return
+	}
+	h.record(c, "user.recovery_codes_regenerate", "user", user.ID.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// secondFactorOK checks a code under the same lockout as logins, so codes
+// cannot be guessed faster through one endpoint than another. It answers
+// the request itself when the code is not accepted.
+func (h *Handler) secondFactorOK(c *gin.Context, user models.User, code string) bool {
+	attempt := h.reserveLogin(c, user.Email)
+	if attempt == nil {
+		return false
+	}
+	ok, err := h.checkSecondFactor(user, code)
+	if err != nil {
+		_ = h.guard.Release(attempt)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return false
+	}
+	if !ok {
+		h.loginFailed(c, user.Email, attempt)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return false
+	}
+	_ = h.guard.Succeed(attempt)
+	return true
+}
+
+func recoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func (h *Handler) GetSettings(c *gin.Context) {
+	current, err := h.settings.Get()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load settings"})
+		return
+	}
+	c.JSON(http.StatusOK, current)
+}
+
+type updateSettingsRequest struct {
+	RequireAdmin2FA *bool `json:"requireAdmin2fa"`
+}
+
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	var req updateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	fields := bson.M{}
+	if req.RequireAdmin2FA != nil {
+		if *req.RequireAdmin2FA {
+			// Keep whoever turns the requirement on from losing admin
+			// rights on their next request.
+			user, ok := h.currentUser(c)
+			if !ok {
+				return
+			}
+			if !user.TOTPEnabled {
+				c.JSON(http.StatusConflict, gin.H{"error": "enable two-factor authentication on your own account first"})
+				return
+			}
+		}
+		fields["require_admin_2fa"] = *req.RequireAdmin2FA
+	}
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
+		return
+	}
+	before, err := h.settings.Get()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load settings"})
+		return
+	}
+	updated, err := h.settings.Update(fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings"})
+		return
+	}
+	h.recordChange(c, "settings.update", "settings", updated.ID, before, updated)
+	c.JSON(http.StatusOK, updated)
+}
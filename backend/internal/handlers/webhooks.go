@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/models"
+	"go-mdbook/internal/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxHookBody bounds webhook deliveries; push payloads list every commit
+// pushed, so they can be large.
+const maxHookBody = 5 << 20
+
+// PushHook is called by the Git host on push. A signed push to the book's
+// configured ref queues a build that syncs the new commit first; other
+// deliveries are acknowledged and ignored. Books without a Git source or
+// webhook secret answer 404, like unknown ones.
+func (h *Handler) PushHook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	id, err := primitive.ObjectIDFromHex(c.Param("bookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	var book models.Book
+	err = h.books().FindOne(ctx, bson.M{"_id": id}).Decode(&book)
+	if err != nil || book.Git == nil || book.WebhookSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxHookBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	if len(body) > maxHookBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "payload too large"})
+		return
+	}
+
+	push, err := webhooks.Parse(c.Request.Header, body, book.WebhookSecret)
+	switch {
+	case errors.Is(err, webhooks.ErrSignature), errors.Is(err, webhooks.ErrUnknownSender):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, webhooks.ErrNotPush):
+		c.JSON(http.StatusOK, gin.H{"ignored": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if push.Deleted() {
+		c.JSON(http.StatusOK, gin.H{"ignored": push.Ref + " was deleted"})
+		return
+	}
+	if !push.Matches(book.Git.Ref) {
+		c.JSON(http.StatusOK, gin.H{"ignored": push.Ref + " is not the book's ref"})
+		return
+	}
+
+	build, err := h.queue.EnqueueSync(book, "webhook:"+push.Provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue build"})
+		return
+	}
+	h.record(c, "build.create", "build", build.ID.Hex(), map[string]any{
+		"bookId": book.ID.Hex(), "trigger": build.Trigger, "ref": push.Ref, "commit": push.After,
+	})
+	c.JSON(http.StatusAccepted, build)
+}
+
+// RotateWebhook sets a new webhook secret for the book, enabling its push
+// webhook. The secret is only shown in this response.
+func (h *Handler) RotateWebhook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	secret, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	_, err = h.books().UpdateByID(ctx, book.ID, bson.M{"$set": bson.M{"webhook_secret": secret}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update"})
+		return
+	}
+	h.record(c, "book.webhook_rotate", "book", book.ID.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"path": "/api/hooks/push/" + book.ID.Hex(), "secret": secret})
+}
+
+// DisableWebhook removes the book's webhook secret, so deliveries are
+// rejected until a new one is set.
+func (h *Handler) DisableWebhook(c *gin.Context) {
+	ctx, cancel := h.cfg.Context()
+	defer cancel()
+	book, ok := h.bookByID(c)
+	if !ok {
+		return
+	}
+	_, err := h.books().UpdateByID(ctx, book.ID, bson.M{"$unset": bson.M{"webhook_secret": ""}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update"})
+		return
+	}
+	h.record(c, "book.webhook_disable", "book", book.ID.Hex(), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "webhook disabled"})
+}
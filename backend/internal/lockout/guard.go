@@ -0,0 +1,223 @@
+package lockout
+
+import (
+	"strings"
+	"time"
+
+	"go-mdbook/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// window is how long failures are remembered after the last one.
+const window = 24 * time.Hour
+
+type attempts struct {
+	Key             string    `bson:"_id"`
+	Failures        int       `bson:"failures"`
+	LockedUntil     time.Time `bson:"locked_until"`
+	PrevLockedUntil time.Time `bson:"prev_locked_until"`
+	ExpiresAt       time.Time `bson:"expires_at"`
+}
+
+// Guard counts failed logins per account and per client IP and locks a key
+// out for exponentially growing periods once it passes its threshold.
+// Attempts are reserved before any password is hashed, so locked-out
+// guessing costs no bcrypt work.
+type Guard struct {
+	cfg    config.Config
+	client *mongo.Client
+}
+
+func NewGuard(cfg config.Config, client *mongo.Client) *Guard {
+	return &Guard{cfg: cfg, client: client}
+}
+
+func (g *Guard) attempts() *mongo.Collection {
+	return g.client.Database(g.cfg.MongoDB).Collection("login_attempts")
+}
+
+func AccountKey(username string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Duration is the lockout after the given number of consecutive failures:
+// nothing below threshold, then base doubling with every further failure
+// up to max.
+func Duration(failures, threshold int, base, max time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Attempt is a login attempt reserved with Reserve. It counts as a failure
+// until it is resolved with Succeed or Release.
+type Attempt struct {
+	username string
+	account  slot
+	client   slot
+}
+
+// slot is the attempt's share of one key's count.
+type slot struct {
+	key             string
+	failures        int
+	lockout         time.Duration
+	lockedUntil     time.Time
+	prevLockedUntil time.Time
+}
+
+// Reserve counts an attempt against the account and the client IP before
+// any password is checked, so concurrent guesses cannot slip past the
+// threshold. It returns how long the caller must wait instead when either
+// key is locked.
+func (g *Guard) Reserve(username, ip string, now time.Time) (*Attempt, time.Duration, error) {
+	account, wait, err := g.reserve(AccountKey(username), g.cfg.LoginMaxAttempts, now)
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+	client, wait, err := g.reserve(IPKey(ip), g.cfg.LoginIPMaxAttempts, now)
+	if err != nil || wait > 0 {
+		_ = g.refund(account)
+		return nil, wait, err
+	}
+	return &Attempt{username: username, account: account, client: client}, 0, nil
+}
+
+// reserve adds a failure to key unless it is locked, locking it in the
+// same update once the threshold is reached.
+func (g *Guard) reserve(key string, threshold int, now time.Time) (slot, time.Duration, error) {
+	ctx, cancel := g.cfg.Context()
+	defer cancel()
+	filter := bson.M{"_id": key, "$or": bson.A{
+		bson.M{"locked_until": bson.M{"$exists": false}},
+		bson.M{"locked_until": bson.M{"$lte": now}},
+	}}
+	update := reservation(threshold, g.cfg.LoginLockout, g.cfg.LoginLockoutMax, now)
+	for retry := 0; ; retry++ {
+		var a attempts
+		err := g.attempts().FindOneAndUpdate(ctx, filter, update,
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&a)
+		if err == nil {
+			return slot{
+				key:             key,
+				failures:        a.Failures,
+				lockout:         Duration(a.Failures, threshold, g.cfg.LoginLockout, g.cfg.LoginLockoutMax),
+				lockedUntil:     a.LockedUntil,
+				prevLockedUntil: a.PrevLockedUntil,
+			}, 0, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return slot{}, 0, err
+		}
+		// The key exists but did not match: it is locked, or a concurrent
+		// first attempt created it.
+		var current attempts
+		if err := g.attempts().FindOne(ctx, bson.M{"_id": key}).Decode(&current); err != nil {
+			return slot{}, 0, err
+		}
+		if wait := current.LockedUntil.Sub(now); wait > 0 {
+			return slot{}, wait, nil
+		}
+		if retry == 2 {
+			return slot{}, time.Second, nil
+		}
+	}
+}
+
+// reservation is the update behind reserve: it counts the failure and,
+// from threshold on, locks the key for Duration of the new count.
+func reservation(threshold int, base, max time.Duration, now time.Time) mongo.Pipeline {
+	stages := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"prev_locked_until": "$locked_until",
+		"failures":          bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+		"expires_at":        now.Add(window),
+	}}}}
+	if threshold <= 0 {
+		return stages
+	}
+	lockout := bson.M{"$min": bson.A{
+		max.Milliseconds(),
+		bson.M{"$multiply": bson.A{base.Milliseconds(), bson.M{"$pow": bson.A{2, bson.M{"$subtract": bson.A{"$failures", threshold}}}}}},
+	}}
+	return append(stages, bson.D{{Key: "$set", Value: bson.M{
+		"locked_until": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$failures", threshold}},
+			bson.M{"$add": bson.A{now, lockout}},
+			"$locked_until",
+		}},
+	}}})
+}
+
+// refund takes a reserved failure back, lifting the lock it caused.
+func (g *Guard) refund(s slot) error {
+	ctx, cancel := g.cfg.Context()
+	defer cancel()
+	if s.lockout == 0 {
+		_, err := g.attempts().UpdateOne(ctx,
+			bson.M{"_id": s.key, "failures": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"failures": -1}},
+		)
+		return err
+	}
+	update := bson.M{"$inc": bson.M{"failures": -1}, "$unset": bson.M{"locked_until": ""}}
+	if !s.prevLockedUntil.IsZero() {
+		update = bson.M{"$inc": bson.M{"failures": -1}, "$set": bson.M{"locked_until": s.prevLockedUntil}}
+	}
+	_, err := g.attempts().UpdateOne(ctx, bson.M{"_id": s.key, "locked_until": s.lockedUntil}, update)
+	return err
+}
+
+// Fail returns the lockouts a failed attempt caused for the account and
+// for the IP; each is 0 unless that key just became locked. The failure
+// itself was recorded by Reserve.
+func (a *Attempt) Fail() (account, client time.Duration) {
+	return a.account.lockout, a.client.lockout
+}
+
+// Succeed clears the failures of the account after a successful login.
+// The IP's count only gets this attempt back, so one valid account cannot
+// reset it for guesses against others.
+func (g *Guard) Succeed(a *Attempt) error {
+	ctx, cancel := g.cfg.Context()
+	defer cancel()
+	if _, err := g.attempts().DeleteOne(ctx, bson.M{"_id": AccountKey(a.username)}); err != nil {
+		return err
+	}
+	return g.refund(a.client)
+}
+
+// Release gives back an attempt that ended without a verdict, such as a
+// correct password still awaiting its second factor.
+func (g *Guard) Release(a *Attempt) error {
+	if err := g.refund(a.account); err != nil {
+		return err
+	}
+	return g.refund(a.client)
+}
+
+// Unlock lifts an account's lockout and forgets its failures.
+func (g *Guard) Unlock(username string) (bool, error) {
+	ctx, cancel := g.cfg.Context()
+	defer cancel()
+	res, err := g.attempts().DeleteOne(ctx, bson.M{"_id": AccountKey(username)})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
@@ -0,0 +1,49 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{11, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tc := range cases {
+		if got := Duration(tc.failures, 5, time.Minute, time.Hour); got != tc.want {
+			t.Errorf("Duration(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+	if got := Duration(100, 0, time.Minute, time.Hour); got != 0 {
+		t.Errorf("a threshold of 0 must disable lockouts, got %v", got)
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	if AccountKey(" Ada@Example.org ") != AccountKey("ada@example.org") {
+		t.Fatal("account keys must ignore case and surrounding spaces")
+	}
+	if AccountKey("1.2.3.4") == IPKey("1.2.3.4") {
+		t.Fatal("account and IP keys must not collide")
+	}
+}
+
+func TestReservationLocksFromThreshold(t *testing.T) {
+	now := time.Now()
+	if stages := reservation(0, time.Minute, time.Hour, now); len(stages) != 1 {
+		t.Fatalf("a threshold of 0 must only count attempts, got %d stages", len(stages))
+	}
+	stages := reservation(5, time.Minute, time.Hour, now)
+	if len(stages) != 2 || stages[1][0].Key != "$set" {
+		t.Fatalf("expected the count and the lock in one update, got %v", stages)
+	}
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one message and returns its envelope and data.
+func fakeSMTP(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var lines []string
+		_ = tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				_ = tp.PrintfLine("250-localhost")
+				_ = tp.PrintfLine("250 8BITMIME")
+			case "MAIL", "RCPT":
+				lines = append(lines, line)
+				_ = tp.PrintfLine("250 ok")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				lines = append(lines, data...)
+				_ = tp.PrintfLine("250 queued")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				got <- lines
+				return
+			default:
+				_ = tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, got := fakeSMTP(t)
+	m := &SMTPMailer{Addr: addr, From: "Docs <noreply@example.com>"}
+	err := m.Send(Message{To: "new@example.com", Subject: "You're invited", Body: "Hello\n.\nbye"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	lines := <-got
+	text := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<noreply@example.com>",
+		"RCPT TO:<new@example.com>",
+		`From: "Docs" <noreply@example.com>`,
+		"To: <new@example.com>",
+		"Subject: You're invited",
+		"Hello\n.\nbye",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("message missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestSMTPMailerRejectsBadAddresses(t *testing.T) {
+	m := &SMTPMailer{Addr: "127.0.0.1:1", From: "noreply@example.com"}
+	if err := m.Send(Message{To: "not an address\r\nBcc: x@example.com"}); err == nil {
+		t.Fatalf("expected an invalid recipient to be refused")
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"net/http"
 	"strings"
 
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/apitokens"
 	"go-mdbook/internal/auth"
-	"go-mdbook/internal/config"
+	"go-mdbook/internal/sessions"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func CORS() gin.HandlerFunc {
@@ -23,7 +26,8 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
-func Auth(cfg config.Config) gin.HandlerFunc {
+// Auth accepts either a session access token or an API token.
+func Auth(keys *auth.KeySet, sess *sessions.Store, tokens *apitokens.Store, resolver *access.Resolver) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -35,23 +39,104 @@ func Auth(cfg config.Config) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid auth"})
 			return
 		}
-		claims, err := auth.ParseToken(cfg, parts[1])
+		if apitokens.IsToken(parts[1]) {
+			tokenAuth(c, tokens, resolver, parts[1])
+			return
+		}
+		claims, err := keys.ParseToken(parts[1])
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
+		if !sess.Active(claims.SessionID) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			return
+		}
+		userID, err := primitive.ObjectIDFromHex(claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		subject, err := resolver.Resolve(userID, claims.Role)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve groups"})
+			return
+		}
 		c.Set("userId", claims.UserID)
-		c.Set("role", claims.Role)
+		c.Set("sessionId", claims.SessionID)
+		c.Set("role", subject.Role)
+		c.Set("subject", subject)
+		c.Next()
+	}
+}
+
+func tokenAuth(c *gin.Context, tokens *apitokens.Store, resolver *access.Resolver, raw string) {
+	token, err := tokens.Authenticate(raw)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	subject, err := resolver.ResolveUser(token.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	subject.Scopes = token.Scopes
+	if subject.Scopes == nil {
+		subject.Scopes = []string{}
+	}
+	c.Set("userId", token.UserID.Hex())
+	c.Set("role", subject.Role)
+	c.Set("subject", subject)
+	c.Set("apiTokenId", token.ID.Hex())
+	c.Next()
+}
+
+// RequireSession refuses API tokens on routes that manage credentials,
+// so a leaked token cannot be used to mint more or change the password.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("apiTokenId") != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with an api token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission allows the request when the caller's role grants perm.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !subjectFrom(c).Can(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
 		c.Next()
 	}
 }
 
-func RequireRole(role string) gin.HandlerFunc {
+// RequireBookPermission allows the request when the caller may perform perm
+// on the book named by the :id route parameter (or owning the :buildId
+// build), either through their role or as a maintainer of that book.
+func RequireBookPermission(perm string, resolver *access.Resolver) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.GetString("role") != role {
+		subject := subjectFrom(c)
+		if subject.Can(perm) {
+			c.Next()
+			return
+		}
+		book, err := resolver.Book(c.Param("id"), c.Param("buildId"))
+		if err != nil || !subject.CanOnBook(book, perm) {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 		c.Next()
 	}
 }
+
+func subjectFrom(c *gin.Context) access.Subject {
+	if v, ok := c.Get("subject"); ok {
+		return v.(access.Subject)
+	}
+	return access.Subject{}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type User struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -8,8 +12,30 @@ type User struct {
 	PasswordHash string             `bson:"password_hash" json:"-"`
 	Role         string             `bson:"role" json:"role"`
 	Active       bool               `bson:"active" json:"active"`
+
+	// AuthSource names the external provider that created the account.
+	// Local accounts leave it empty.
+	AuthSource  string `bson:"auth_source,omitempty" json:"authSource,omitempty"`
+	OIDCSubject string `bson:"oidc_subject,omitempty" json:"-"`
+	// OIDCLinkAllowed lets the next single sign-on with the account's email
+	// link to it. Only admins set it.
+	OIDCLinkAllowed bool `bson:"oidc_link_allowed,omitempty" json:"oidcLinkAllowed,omitempty"`
+
+	// TOTPPendingSecret holds a secret during enrollment until a code from
+	// it has been verified. TOTPLastStep is the time step of the last code
+	// accepted, so codes cannot be replayed.
+	TOTPEnabled       bool     `bson:"totp_enabled,omitempty" json:"totpEnabled"`
+	TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+	TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"`
+	TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`
+	RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`
 }
 
+const (
+	AuthSourceOIDC = "oidc"
+	AuthSourceLDAP = "ldap"
+)
+
 type Book struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Title     string             `bson:"title" json:"title"`
@@ -17,4 +43,216 @@ type Book struct {
 	SourceDir string             `bson:"source_dir" json:"sourceDir"`
 	BuildDir  string             `bson:"build_dir" json:"buildDir"`
 	Active    bool               `bson:"active" json:"active"`
+
+	// OutputDir is the rendered output currently served to readers. It is
+	// replaced in one update when a build succeeds, unless the book is
+	// pinned to PublishedBuildID; books built before builds rendered into
+	// their own directory have it unset and are served from BuildDir.
+	OutputDir        string              `bson:"output_dir,omitempty" json:"-"`
+	CurrentBuildID   *primitive.ObjectID `bson:"current_build_id,omitempty" json:"currentBuildId,omitempty"`
+	PublishedBuildID *primitive.ObjectID `bson:"published_build_id,omitempty" json:"publishedBuildId,omitempty"`
+	BuildSeq         int                 `bson:"build_seq,omitempty" json:"-"`
+
+	RevisionSeq    int `bson:"revision_seq,omitempty" json:"-"`
+	ActiveRevision int `bson:"active_revision,omitempty" json:"activeRevision,omitempty"`
+
+	// Restricted books are only visible to admins and the subjects listed
+	// in Grants; everyone else sees unrestricted books only.
+	Restricted bool    `bson:"restricted,omitempty" json:"restricted"`
+	Grants     []Grant `bson:"grants,omitempty" json:"-"`
+
+	// Git is where the source is synced from, if anywhere. GitSHA is the
+	// commit of the last sync and LastBuiltSHA that of the last successful
+	// build; Poll reports the poller's last check of the remote.
+	Git          *GitSource  `bson:"git,omitempty" json:"git,omitempty"`
+	GitSHA       string      `bson:"git_sha,omitempty" json:"gitSha,omitempty"`
+	SyncedAt     *time.Time  `bson:"synced_at,omitempty" json:"syncedAt,omitempty"`
+	LastBuiltSHA string      `bson:"last_built_sha,omitempty" json:"lastBuiltSha,omitempty"`
+	Poll         *PollStatus `bson:"poll,omitempty" json:"poll,omitempty"`
+
+	// WebhookSecret authenticates push webhooks for the book. It is kept
+	// in the clear because HMAC signatures are checked against it.
+	WebhookSecret string `bson:"webhook_secret,omitempty" json:"-"`
+}
+
+// GitSource locates a book's source in a Git repository. CredentialsRef
+// names a secret configured on the server; the secret itself is never
+// stored with the book.
+type GitSource struct {
+	URL            string `bson:"url" json:"url"`
+	Ref            string `bson:"ref,omitempty" json:"ref,omitempty"`
+	Subdir         string `bson:"subdir,omitempty" json:"subdir,omitempty"`
+	CredentialsRef string `bson:"credentials_ref,omitempty" json:"credentialsRef,omitempty"`
+
+	// Poll has the server check the remote periodically, for hosts that
+	// cannot send push webhooks.
+	Poll bool `bson:"poll,omitempty" json:"poll,omitempty"`
+}
+
+// PollStatus is the outcome of the poller's last check of a book's Git
+// source. QueuedSHA is the last commit a build was queued for, which is
+// not queued again even if that build fails.
+type PollStatus struct {
+	CheckedAt *time.Time          `bson:"checked_at,omitempty" json:"checkedAt,omitempty"`
+	NextAt    time.Time           `bson:"next_at" json:"nextAt"`
+	RemoteSHA string              `bson:"remote_sha,omitempty" json:"remoteSha,omitempty"`
+	Error     string              `bson:"error,omitempty" json:"error,omitempty"`
+	QueuedSHA string              `bson:"queued_sha,omitempty" json:"queuedSha,omitempty"`
+	BuildID   *primitive.ObjectID `bson:"build_id,omitempty" json:"buildId,omitempty"`
+}
+
+const (
+	GrantSubjectUser  = "user"
+	GrantSubjectGroup = "group"
+
+	GrantRead     = "read"
+	GrantMaintain = "maintain"
+)
+
+type Grant struct {
+	Subject string             `bson:"subject" json:"subject"`
+	ID      primitive.ObjectID `bson:"id" json:"id"`
+	Level   string             `bson:"level" json:"level"`
+}
+
+const (
+	BuildQueued    = "queued"
+	BuildRunning   = "running"
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+	BuildCancelled = "cancelled"
+	BuildTimedOut  = "timed_out"
+)
+
+type Build struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	BookID      primitive.ObjectID `bson:"book_id" json:"bookId"`
+	Number      int                `bson:"number" json:"number"`
+	Status      string             `bson:"status" json:"status"`
+	TriggeredBy primitive.ObjectID `bson:"triggered_by" json:"triggeredBy"`
+	Revision    int                `bson:"revision,omitempty" json:"revision,omitempty"`
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	OutputDir   string             `bson:"output_dir,omitempty" json:"-"`
+	Pruned      bool               `bson:"pruned,omitempty" json:"pruned,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	StartedAt   *time.Time         `bson:"started_at,omitempty" json:"startedAt,omitempty"`
+	FinishedAt  *time.Time         `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+
+	// Sync builds first sync the book's Git source; Commit is the commit
+	// that was built. Trigger names what queued builds nobody started by
+	// hand, such as "webhook:github".
+	Sync    bool   `bson:"sync,omitempty" json:"sync,omitempty"`
+	Commit  string `bson:"commit,omitempty" json:"commit,omitempty"`
+	Trigger string `bson:"trigger,omitempty" json:"trigger,omitempty"`
+}
+
+type BuildLogLine struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	BuildID primitive.ObjectID `bson:"build_id" json:"buildId"`
+	Seq     int                `bson:"seq" json:"seq"`
+	Stream  string             `bson:"stream" json:"stream"`
+	Text    string             `bson:"text" json:"text"`
+	Time    time.Time          `bson:"time" json:"time"`
+}
+
+type Revision struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	BookID      primitive.ObjectID `bson:"book_id" json:"bookId"`
+	Number      int                `bson:"number" json:"number"`
+	UploadedBy  primitive.ObjectID `bson:"uploaded_by" json:"uploadedBy"`
+	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	Filename    string             `bson:"filename" json:"filename"`
+	Checksum    string             `bson:"checksum" json:"checksum"`
+	Size        int64              `bson:"size" json:"size"`
+	ArchivePath string             `bson:"archive_path" json:"-"`
+	Commit      string             `bson:"commit,omitempty" json:"commit,omitempty"`
+}
+
+type Session struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID          primitive.ObjectID `bson:"user_id" json:"userId"`
+	RefreshHash     string             `bson:"refresh_hash" json:"-"`
+	PrevRefreshHash string             `bson:"prev_refresh_hash,omitempty" json:"-"`
+	UserAgent       string             `bson:"user_agent,omitempty" json:"userAgent,omitempty"`
+	IP              string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"createdAt"`
+	LastUsedAt      time.Time          `bson:"last_used_at" json:"lastUsedAt"`
+	ExpiresAt       time.Time          `bson:"expires_at" json:"expiresAt"`
+	RevokedAt       *time.Time         `bson:"revoked_at,omitempty" json:"revokedAt,omitempty"`
+}
+
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"userId"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"createdBy"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty" json:"usedAt,omitempty"`
+}
+
+// Invite lets someone create their own account with a preset role. Only a
+// hash of the token is stored; accepting it sets AcceptedAt and UserID.
+type Invite struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Email      string              `bson:"email" json:"email"`
+	Role       string              `bson:"role" json:"role"`
+	TokenHash  string              `bson:"token_hash" json:"-"`
+	CreatedBy  primitive.ObjectID  `bson:"created_by" json:"createdBy"`
+	CreatedAt  time.Time           `bson:"created_at" json:"createdAt"`
+	ExpiresAt  time.Time           `bson:"expires_at" json:"expiresAt"`
+	AcceptedAt *time.Time          `bson:"accepted_at,omitempty" json:"acceptedAt,omitempty"`
+	UserID     *primitive.ObjectID `bson:"user_id,omitempty" json:"userId,omitempty"`
+}
+
+// Group members inherit the group's role (when set) and its book grants.
+type Group struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name        string               `bson:"name" json:"name"`
+	Description string               `bson:"description,omitempty" json:"description,omitempty"`
+	Role        string               `bson:"role,omitempty" json:"role,omitempty"`
+	MemberIDs   []primitive.ObjectID `bson:"member_ids" json:"memberIds"`
+	CreatedAt   time.Time            `bson:"created_at" json:"createdAt"`
+}
+
+// APIToken is a long-lived credential for automation. It acts as its user,
+// limited to Scopes; only a hash of the secret is stored.
+type APIToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"userId"`
+	Name       string             `bson:"name" json:"name"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revokedAt,omitempty"`
+}
+
+// Settings is the single document of server-wide options changed at
+// runtime by admins.
+type Settings struct {
+	ID              string `bson:"_id" json:"-"`
+	RequireAdmin2FA bool   `bson:"require_admin_2fa" json:"requireAdmin2fa"`
+}
+
+// AuditEvent records a security-relevant action. Events are only ever
+// inserted.
+type AuditEvent struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Time       time.Time           `bson:"time" json:"time"`
+	ActorID    *primitive.ObjectID `bson:"actor_id,omitempty" json:"actorId,omitempty"`
+	Action     string              `bson:"action" json:"action"`
+	TargetType string              `bson:"target_type" json:"targetType"`
+	TargetID   string              `bson:"target_id" json:"targetId"`
+	IP         string              `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details    map[string]any      `bson:"details,omitempty" json:"details,omitempty"`
+	Changes    map[string]Change   `bson:"changes,omitempty" json:"changes,omitempty"`
+}
+
+// Change is the value of one field before and after an audited update.
+// Before is nil for created objects and After for deleted ones.
+type Change struct {
+	Before any `bson:"before" json:"before"`
+	After  any `bson:"after" json:"after"`
 }
@@ -0,0 +1,191 @@
+package poller
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go-mdbook/internal/audit"
+	"go-mdbook/internal/builds"
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/gitsource"
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// jitter is the fraction of the interval by which checks are randomly
+// moved, so books added together do not keep hitting their hosts at the
+// same moment.
+const jitter = 0.1
+
+// workers bounds how many remotes are checked at once, so one slow host
+// does not hold up the other books.
+const workers = 4
+
+// Poller checks the Git source of books with polling enabled every
+// GIT_POLL_INTERVAL and queues a sync build when the remote has moved to a
+// commit that has not been built yet. When each book is due is stored with
+// the book, so restarts keep the schedule.
+type Poller struct {
+	cfg    config.Config
+	client *mongo.Client
+	git    *gitsource.Fetcher
+	queue  *builds.Queue
+	audit  *audit.Logger
+}
+
+func New(cfg config.Config, client *mongo.Client, queue *builds.Queue) *Poller {
+	return &Poller{
+		cfg:    cfg,
+		client: client,
+		git:    gitsource.NewFetcher(cfg),
+		queue:  queue,
+		audit:  audit.NewLogger(cfg, client),
+	}
+}
+
+func (p *Poller) books() *mongo.Collection {
+	return p.client.Database(p.cfg.MongoDB).Collection("books")
+}
+
+// Start runs the poller until ctx is done. A GIT_POLL_INTERVAL of 0
+// disables it.
+func (p *Poller) Start(ctx context.Context) {
+	if p.cfg.GitPoll <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(tick(p.cfg.GitPoll))
+		defer ticker.Stop()
+		for {
+			p.pollDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// tick is how often the poller looks for due books: often enough that
+// jitter is not swamped by it, without busy-looping on short intervals.
+func tick(interval time.Duration) time.Duration {
+	d := time.Duration(float64(interval) * jitter / 2)
+	if d < time.Second {
+		return time.Second
+	}
+	if d > time.Minute {
+		return time.Minute
+	}
+	return d
+}
+
+// nextCheck returns when a book checked at now is due again: one interval
+// later, give or take the jitter. rnd returns values in [0, 1).
+func nextCheck(now time.Time, interval time.Duration, rnd func() float64) time.Time {
+	offset := (rnd()*2 - 1) * jitter * float64(interval)
+	return now.Add(interval + time.Duration(offset))
+}
+
+func (p *Poller) pollDue(ctx context.Context) {
+	now := time.Now()
+	due, err := p.due(now)
+	if err != nil {
+		log.Printf("git poll: list books: %v", err)
+		return
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+	defer wg.Wait()
+	for _, book := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if book.Poll == nil {
+			// Spread the first checks of newly enabled books (and of all
+			// books after an upgrade) over one interval.
+			first := now.Add(time.Duration(rand.Float64() * float64(p.cfg.GitPoll)))
+			p.save(book, models.PollStatus{NextAt: first})
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(book models.Book) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			p.check(ctx, book)
+		}(book)
+	}
+}
+
+// due lists the books with polling enabled whose next check is at or
+// before now.
+func (p *Poller) due(now time.Time) ([]models.Book, error) {
+	ctx, cancel := p.cfg.Context()
+	defer cancel()
+	cur, err := p.books().Find(ctx, bson.M{
+		"active":   true,
+		"git.poll": true,
+		"$or":      []bson.M{{"poll.next_at": bson.M{"$lte": now}}, {"poll.next_at": nil}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var due []models.Book
+	err = cur.All(ctx, &due)
+	return due, err
+}
+
+// check compares the remote head of book's source with its last built
+// commit and queues a sync build when they differ.
+func (p *Poller) check(ctx context.Context, book models.Book) {
+	now := time.Now()
+	status := models.PollStatus{
+		CheckedAt: &now,
+		NextAt:    nextCheck(now, p.cfg.GitPoll, rand.Float64),
+		QueuedSHA: book.Poll.QueuedSHA,
+		BuildID:   book.Poll.BuildID,
+	}
+	sha, err := p.git.RemoteHead(ctx, *book.Git)
+	if err != nil {
+		status.Error = err.Error()
+		p.save(book, status)
+		return
+	}
+	status.RemoteSHA = sha
+	if sha != book.LastBuiltSHA && sha != book.Poll.QueuedSHA {
+		build, err := p.queue.EnqueueSync(book, "poll")
+		if err != nil {
+			status.Error = "queue build: " + err.Error()
+		} else {
+			status.QueuedSHA = sha
+			status.BuildID = &build.ID
+			p.audit.Record(models.AuditEvent{
+				Action:     "build.create",
+				TargetType: "build",
+				TargetID:   build.ID.Hex(),
+				Details:    map[string]any{"bookId": book.ID.Hex(), "trigger": build.Trigger, "commit": sha},
+			})
+		}
+	}
+	p.save(book, status)
+}
+
+// save stores status unless the book's source changed meanwhile, which
+// resets the status.
+func (p *Poller) save(book models.Book, status models.PollStatus) {
+	ctx, cancel := p.cfg.Context()
+	defer cancel()
+	_, err := p.books().UpdateOne(ctx,
+		bson.M{"_id": book.ID, "git": book.Git},
+		bson.M{"$set": bson.M{"poll": status}},
+	)
+	if err != nil {
+		log.Printf("git poll: book %s: save status: %v", book.ID.Hex(), err)
+	}
+}
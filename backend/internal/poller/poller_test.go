@@ -0,0 +1,41 @@
+package poller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCheckJitter(t *testing.T) {
+	now := time.Date(2024, 5, 14, 12, 0, 0, 0, time.UTC)
+	interval := 10 * time.Minute
+	cases := []struct {
+		rnd  float64
+		want time.Duration
+	}{
+		{0, 9 * time.Minute},
+		{0.5, 10 * time.Minute},
+		{0.999999, 11 * time.Minute},
+	}
+	for _, tc := range cases {
+		got := nextCheck(now, interval, func() float64 { return tc.rnd }).Sub(now)
+		if d := got - tc.want; d < -time.Second || d > time.Second {
+			t.Errorf("rnd %v: next check after %v, want about %v", tc.rnd, got, tc.want)
+		}
+	}
+}
+
+func TestTick(t *testing.T) {
+	cases := []struct {
+		interval time.Duration
+		want     time.Duration
+	}{
+		{5 * time.Second, time.Second},
+		{5 * time.Minute, 15 * time.Second},
+		{time.Hour, time.Minute},
+	}
+	for _, tc := range cases {
+		if got := tick(tc.interval); got != tc.want {
+			t.Errorf("tick(%v) = %v, want %v", tc.interval, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "book")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.md"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	staged, err := StagingDir(dir)
+	if err != nil {
+		t.Fatalf("staging error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(staged, "new.md"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceDir(dir, staged); err != nil {
+		t.Fatalf("replace error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "new.md")); err != nil {
+		t.Fatalf("expected new content: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected old content to be gone, got %v", err)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Fatalf("expected only the book dir to remain, got %d entries", len(entries))
+	}
+}
+
+func TestCopyFileChecksum(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.zip")
+	if err := os.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, size, err := CopyFile(src, filepath.Join(dir, "revs", "1.zip"))
+	if err != nil {
+		t.Fatalf("copy error: %v", err)
+	}
+	if size != 5 || sum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected result: %s %d", sum, size)
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "src", "img"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "src", "SUMMARY.md"), []byte("# Summary"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(src, "src", "link.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := CopyDir(src, dst); err != nil {
+		t.Fatalf("copy error: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "src", "SUMMARY.md")); err != nil || string(data) != "# Summary" {
+		t.Fatalf("SUMMARY.md: %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "src", "img")); err != nil || !info.IsDir() {
+		t.Fatalf("expected empty directories to be copied: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "src", "link.md")); err == nil {
+		t.Fatal("expected the symlink to be skipped")
+	}
+}
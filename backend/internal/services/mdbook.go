@@ -1,15 +1,77 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
+	"sync"
+	"time"
 )
 
-func BuildBook(sourceDir, buildDir string) error {
-	cmd := exec.Command("mdbook", "build", sourceDir, "-d", buildDir)
-	out, err := cmd.CombinedOutput()
+// BuildBook runs mdbook and reports every line it prints to onLine, tagged
+// with the stream ("stdout" or "stderr") it came from. When ctx is done the
+// whole mdbook process group is killed, preprocessors included.
+func BuildBook(ctx context.Context, sourceDir, buildDir string, onLine func(stream, line string)) error {
+	cmd := exec.CommandContext(ctx, "mdbook", "build", sourceDir, "-d", buildDir)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+
+	var mu sync.Mutex
+	stdout := &lineWriter{stream: "stdout", mu: &mu, onLine: onLine}
+	stderr := &lineWriter{stream: "stderr", mu: &mu, onLine: onLine}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
 	if err != nil {
-		return fmt.Errorf("mdbook build failed: %w: %s", err, string(out))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("mdbook build stopped: %w", ctxErr)
+		}
+		return fmt.Errorf("mdbook build failed: %w", err)
 	}
 	return nil
 }
+
+// maxLineSize caps a reported line; longer output is split into chunks of
+// this size so a stream without newlines cannot grow the buffer unbounded.
+const maxLineSize = 1024 * 1024
+
+// lineWriter splits a process stream into lines. Writers of the same
+// process share mu so onLine is never called concurrently.
+type lineWriter struct {
+	stream string
+	mu     *sync.Mutex
+	onLine func(stream, line string)
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		switch {
+		case i >= 0 && i <= maxLineSize:
+			w.onLine(w.stream, string(bytes.TrimRight(w.buf[:i], "\r")))
+			w.buf = w.buf[i+1:]
+		case len(w.buf) >= maxLineSize:
+			w.onLine(w.stream, string(w.buf[:maxLineSize]))
+			w.buf = w.buf[maxLineSize:]
+		default:
+			return len(p), nil
+		}
+	}
+}
+
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.onLine(w.stream, string(w.buf))
+		w.buf = nil
+	}
+}
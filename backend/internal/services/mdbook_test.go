@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func fakeMdbook(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script stub requires a unix shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mdbook"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write stub: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestBuildBookReportsLines(t *testing.T) {
+	fakeMdbook(t, "echo building\necho 'warning: broken link' >&2\nprintf 'done'\n")
+
+	var lines []string
+	err := BuildBook(context.Background(), "src", "out", func(stream, line string) {
+		lines = append(lines, stream+":"+line)
+	})
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+	want := map[string]bool{"stdout:building": true, "stderr:warning: broken link": true, "stdout:done": true}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+	for _, l := range lines {
+		if !want[l] {
+			t.Fatalf("unexpected line %q in %q", l, lines)
+		}
+	}
+}
+
+func TestBuildBookKillsOnTimeout(t *testing.T) {
+	// The child sleep keeps the output pipes open; only killing the whole
+	// process group lets the build return promptly.
+	fakeMdbook(t, "sleep 30 &\nwait\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := BuildBook(ctx, "src", "out", func(string, string) {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("build took %v to stop", elapsed)
+	}
+}
+
+func TestLineWriterSplitsLongLines(t *testing.T) {
+	var lines []string
+	w := &lineWriter{stream: "stdout", mu: &sync.Mutex{}, onLine: func(_, line string) {
+		lines = append(lines, line)
+	}}
+	chunk := strings.Repeat("x", 64*1024)
+	for i := 0; i < 40; i++ {
+		_, _ = w.Write([]byte(chunk))
+		if len(w.buf) >= maxLineSize {
+			t.Fatalf("buffer grew to %d bytes", len(w.buf))
+		}
+	}
+	_, _ = w.Write([]byte("\nshort\n"))
+	if len(lines) != 4 || len(lines[0]) != maxLineSize || len(lines[2]) != 40*len(chunk)-2*maxLineSize || lines[3] != "short" {
+		t.Fatalf("unexpected lines: %d", len(lines))
+	}
+}
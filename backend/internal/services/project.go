@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Problem is one reason a source tree is not a buildable mdBook project.
+type Problem struct {
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// ProjectError lists every problem found in a source tree.
+type ProjectError struct {
+	Problems []Problem
+}
+
+func (e *ProjectError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Message
+		if p.Path != "" {
+			msgs[i] = p.Path + ": " + p.Message
+		}
+	}
+	return "invalid mdBook project: " + strings.Join(msgs, "; ")
+}
+
+// bookConfig is the part of book.toml that decides where the source is.
+type bookConfig struct {
+	Book struct {
+		Src string `toml:"src"`
+	} `toml:"book"`
+}
+
+// PrepareProject checks that dir holds an mdBook project, as extracted
+// from an archive. When book.toml is not at the top but the archive has a
+// single top-level directory, that directory is stripped first. It returns
+// a *ProjectError when the project cannot be built. A missing book.toml
+// does not stop the checks, since mdBook then looks for the default src;
+// an unusable book.src does, since the source could be anywhere.
+func PrepareProject(dir string) error {
+	if err := stripWrapper(dir); err != nil {
+		return err
+	}
+
+	var problems []Problem
+	var cfg bookConfig
+	data, err := os.ReadFile(filepath.Join(dir, "book.toml"))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		problems = append(problems, Problem{Path: "book.toml", Message: "not found at the top of the archive"})
+	case err != nil:
+		return err
+	default:
+		if err := toml.Unmarshal(data, &cfg); err != nil {
+			msg := err.Error()
+			var decodeErr *toml.DecodeError
+			if errors.As(err, &decodeErr) {
+				row, col := decodeErr.Position()
+				msg = fmt.Sprintf("line %d, column %d: %s", row, col, decodeErr.Error())
+			}
+			return &ProjectError{Problems: []Problem{{Path: "book.toml", Message: msg}}}
+		}
+	}
+
+	src := cfg.Book.Src
+	if src == "" {
+		src = "src"
+	}
+	clean := path.Clean(strings.ReplaceAll(src, "\\", "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return &ProjectError{Problems: []Problem{{Path: "book.toml", Message: fmt.Sprintf("book.src %q is outside the project", src)}}}
+	}
+	info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(clean)))
+	if err != nil || !info.IsDir() {
+		problems = append(problems, Problem{Path: clean, Message: "source directory not found"})
+	} else {
+		summary := path.Join(clean, "SUMMARY.md")
+		info, err = os.Stat(filepath.Join(dir, filepath.FromSlash(summary)))
+		if err != nil || !info.Mode().IsRegular() {
+			problems = append(problems, Problem{Path: summary, Message: "not found"})
+		}
+	}
+	if len(problems) > 0 {
+		return &ProjectError{Problems: problems}
+	}
+	return nil
+}
+
+// stripWrapper moves the contents of a single top-level directory up into
+// dir, unless dir already has a book.toml. Entries archivers add on their
+// own, such as __MACOSX, do not count as a second top-level entry and are
+// dropped.
+func stripWrapper(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "book.toml")); err == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var wrapper os.DirEntry
+	for _, e := range entries {
+		if isArchiverJunk(e.Name()) {
+			continue
+		}
+		if wrapper != nil || !e.IsDir() {
+			return nil
+		}
+		wrapper = e
+	}
+	if wrapper == nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e != wrapper {
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Move the wrapper aside first, in case it contains an entry of its
+	// own name.
+	tmp, err := os.MkdirTemp(dir, ".wrapper-")
+	if err != nil {
+		return err
+	}
+	inner := filepath.Join(tmp, "root")
+	if err := os.Rename(filepath.Join(dir, wrapper.Name()), inner); err != nil {
+		return err
+	}
+	children, err := os.ReadDir(inner)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(inner, child.Name()), filepath.Join(dir, child.Name())); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(tmp)
+}
+
+func isArchiverJunk(name string) bool {
+	return name == "__MACOSX" || name == ".DS_Store" || name == "Thumbs.db"
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPrepareProjectValid(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "top level",
+			files: map[string]string{"book.toml": "[book]\ntitle = \"T\"\n", "src/SUMMARY.md": "# Summary"},
+			want:  []string{"book.toml", "src/SUMMARY.md"},
+		},
+		{
+			name: "wrapped",
+			files: map[string]string{
+				"my-book/book.toml":      "",
+				"my-book/src/SUMMARY.md": "",
+				"__MACOSX/my-book/._x":   "",
+			},
+			want: []string{"book.toml", "src/SUMMARY.md"},
+		},
+		{
+			name:  "wrapper containing its own name",
+			files: map[string]string{"src/book.toml": "", "src/src/SUMMARY.md": ""},
+			want:  []string{"book.toml", "src/SUMMARY.md"},
+		},
+		{
+			name:  "custom src",
+			files: map[string]string{"book.toml": "[book]\nsrc = \"content\"\n", "content/SUMMARY.md": ""},
+			want:  []string{"book.toml", "content/SUMMARY.md"},
+		},
+	}
+	for _, tc := range cases {
+		dir := writeTree(t, tc.files)
+		if err := PrepareProject(dir); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		for _, name := range tc.want {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("%s: expected %s: %v", tc.name, name, err)
+			}
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != len(tc.want) {
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			t.Errorf("%s: left %v at the top", tc.name, names)
+		}
+	}
+}
+
+func TestPrepareProjectProblems(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		paths []string
+		msg   string
+	}{
+		{"empty", map[string]string{}, []string{"book.toml", "src"}, "not found"},
+		{"no book.toml", map[string]string{"README.md": "", "src/SUMMARY.md": ""}, []string{"book.toml"}, "not found"},
+		{"no book.toml or summary", map[string]string{"README.md": "", "src/intro.md": ""}, []string{"book.toml", "src/SUMMARY.md"}, "not found"},
+		{"two wrappers", map[string]string{"a/book.toml": "", "b/book.toml": ""}, []string{"book.toml", "src"}, "not found"},
+		{"bad toml", map[string]string{"book.toml": "[book]\ntitle = \n"}, []string{"book.toml"}, "line 2"},
+		{"missing src", map[string]string{"book.toml": ""}, []string{"src"}, "source directory not found"},
+		{"missing summary", map[string]string{"book.toml": "", "src/intro.md": ""}, []string{"src/SUMMARY.md"}, "not found"},
+		{"src outside", map[string]string{"book.toml": "[book]\nsrc = \"../etc\"\n"}, []string{"book.toml"}, "outside the project"},
+	}
+	for _, tc := range cases {
+		err := PrepareProject(writeTree(t, tc.files))
+		var projectErr *ProjectError
+		if !errors.As(err, &projectErr) || len(projectErr.Problems) != len(tc.paths) {
+			t.Errorf("%s: got %v, want problems with %v", tc.name, err, tc.paths)
+			continue
+		}
+		for i, p := range projectErr.Problems {
+			if p.Path != tc.paths[i] {
+				t.Errorf("%s: problem %d is about %q, want %q", tc.name, i, p.Path, tc.paths[i])
+			}
+		}
+		if p := projectErr.Problems[0]; !strings.Contains(p.Message, tc.msg) {
+			t.Errorf("%s: got %+v, want ...%s...", tc.name, p, tc.msg)
+		}
+	}
+}
@@ -3,19 +3,71 @@ package services
 import (
 	"archive/zip"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-func ExtractZip(zipPath, destDir string) error {
+// ErrUnsupportedEntry is returned for zip entries that are neither regular
+// files nor directories, such as symlinks and devices.
+var ErrUnsupportedEntry = errors.New("unsupported zip entry")
+
+// ratioFloor is how far an entry may expand before its compression ratio
+// is checked, so small, highly compressible files such as blank pages pass.
+const ratioFloor = 1 << 20
+
+// ZipLimits bounds what extracting an archive may write. Zero fields are
+// not enforced.
+type ZipLimits struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxTotalSize int64
+	MaxRatio     int64
+}
+
+// LimitError reports an archive exceeding one of its ZipLimits.
+type LimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("archive exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// check reports whether an entry that has expanded to n bytes out of
+// compressed, with total bytes extracted so far, is within the limits.
+func (l ZipLimits) check(n, compressed, total int64) error {
+	switch {
+	case l.MaxFileSize > 0 && n > l.MaxFileSize:
+		return &LimitError{Limit: "file size", Max: l.MaxFileSize}
+	case l.MaxTotalSize > 0 && total > l.MaxTotalSize:
+		return &LimitError{Limit: "total size", Max: l.MaxTotalSize}
+	case l.MaxRatio > 0 && n > ratioFloor && n > l.MaxRatio*max(compressed, 1):
+		return &LimitError{Limit: "compression ratio", Max: l.MaxRatio}
+	}
+	return nil
+}
+
+// ExtractZip unpacks the regular files and directories of the archive into
+// destDir. Limits are checked against the sizes entries declare and again
+// while they are written, since declared sizes can lie; extraction stops
+// with a *LimitError as soon as one is exceeded. Mode bits in the archive
+// are ignored.
+func ExtractZip(zipPath, destDir string, limits ZipLimits) error {
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
+	if limits.MaxEntries > 0 && len(reader.File) > limits.MaxEntries {
+		return &LimitError{Limit: "entry count", Max: int64(limits.MaxEntries)}
+	}
+	var total int64
 	for _, file := range reader.File {
 		name := filepath.Clean(file.Name)
 		if strings.HasPrefix(name, "..") || filepath.IsAbs(name) {
@@ -25,6 +77,9 @@ func ExtractZip(zipPath, destDir string) error {
 		if !strings.HasPrefix(filepath.Clean(fullPath)+string(os.PathSeparator), filepath.Clean(destDir)+string(os.PathSeparator)) {
 			return errors.New("zip entry outside destination")
 		}
+		if mode := file.Mode(); mode&fs.ModeType&^fs.ModeDir != 0 {
+			return fmt.Errorf("%w: %s (%s)", ErrUnsupportedEntry, file.Name, mode.Type())
+		}
 
 		if file.FileInfo().IsDir() {
 			if err := os.MkdirAll(fullPath, 0o755); err != nil {
@@ -32,27 +87,60 @@ func ExtractZip(zipPath, destDir string) error {
 			}
 			continue
 		}
-
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		declared := int64(file.UncompressedSize64)
+		if file.UncompressedSize64 > 1<<62 {
+			declared = 1 << 62
+		}
+		if err := limits.check(declared, int64(file.CompressedSize64), total+declared); err != nil {
 			return err
 		}
 
-		in, err := file.Open()
-		if err != nil {
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
 			return err
 		}
-		out, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		n, err := extractFile(file, fullPath, limits, total)
+		total += n
 		if err != nil {
-			_ = in.Close()
-			return err
-		}
-		if _, err := io.Copy(out, in); err != nil {
-			_ = out.Close()
-			_ = in.Close()
 			return err
 		}
-		_ = out.Close()
-		_ = in.Close()
 	}
 	return nil
 }
+
+// extractFile writes one entry to path and returns how many bytes it
+// wrote, stopping once the limits are exceeded.
+func extractFile(file *zip.File, path string, limits ZipLimits, total int64) (int64, error) {
+	in, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	w := &limitedWriter{w: out, limits: limits, compressed: int64(file.CompressedSize64), total: total}
+	_, err = io.Copy(w, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return w.n, err
+}
+
+// limitedWriter fails a write that would take an entry past the limits.
+type limitedWriter struct {
+	w          io.Writer
+	limits     ZipLimits
+	compressed int64
+	total      int64
+	n          int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if err := w.limits.check(w.n+int64(len(p)), w.compressed, w.total+w.n+int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
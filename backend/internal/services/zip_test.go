@@ -0,0 +1,154 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	data []byte
+	mode fs.FileMode
+}
+
+func writeZip(t *testing.T, entries ...zipEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var testLimits = ZipLimits{MaxEntries: 10, MaxFileSize: 4 << 20, MaxTotalSize: 6 << 20, MaxRatio: 100}
+
+func TestExtractZip(t *testing.T) {
+	archive := writeZip(t,
+		zipEntry{name: "book.toml", data: []byte("[book]\n"), mode: 0o777},
+		zipEntry{name: "src/", mode: fs.ModeDir | 0o700},
+		zipEntry{name: "src/SUMMARY.md", data: bytes.Repeat([]byte("- [Chapter](chapter.md)\n"), 1000)},
+	)
+	dir := t.TempDir()
+	if err := ExtractZip(archive, dir, testLimits); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "book.toml"))
+	if err != nil || info.Mode().Perm() != 0o644 {
+		t.Fatalf("book.toml: %v, %v", info, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "src", "SUMMARY.md")); err != nil || len(data) != 24000 {
+		t.Fatalf("SUMMARY.md: %d bytes, %v", len(data), err)
+	}
+}
+
+func TestExtractZipLimits(t *testing.T) {
+	many := make([]zipEntry, 11)
+	for i := range many {
+		many[i] = zipEntry{name: filepath.Join("src", string(rune('a'+i))+".md"), data: []byte("x")}
+	}
+	random := make([]byte, 3<<20)
+	for i := range random {
+		random[i] = byte(crc32.ChecksumIEEE([]byte{byte(i), byte(i >> 8), byte(i >> 16)}))
+	}
+	cases := []struct {
+		name    string
+		entries []zipEntry
+		limit   string
+	}{
+		{"entries", many, "entry count"},
+		{"file size", []zipEntry{{name: "big.md", data: append(random, random[:2<<20]...)}}, "file size"},
+		{"total size", []zipEntry{{name: "a.md", data: random}, {name: "b.md", data: random}, {name: "c.md", data: random}}, "total size"},
+		{"ratio", []zipEntry{{name: "bomb.md", data: make([]byte, 3<<20)}}, "compression ratio"},
+	}
+	for _, tc := range cases {
+		err := ExtractZip(writeZip(t, tc.entries...), t.TempDir(), testLimits)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != tc.limit {
+			t.Errorf("%s: got %v, want the %s limit", tc.name, err, tc.limit)
+		}
+	}
+}
+
+// A header understating the size must not get an entry past the limits.
+func TestExtractZipLyingHeader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<18) // 4 MiB
+	path := filepath.Join(t.TempDir(), "lying.zip")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "small.md",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := ExtractZip(path, dir, ZipLimits{MaxFileSize: 1 << 20}); err == nil {
+		t.Fatal("expected the oversized entry to be rejected")
+	}
+	if info, err := os.Stat(filepath.Join(dir, "small.md")); err == nil && info.Size() > 1<<20 {
+		t.Fatalf("wrote %d bytes past the limit", info.Size())
+	}
+}
+
+func TestExtractZipRejectsSpecialEntries(t *testing.T) {
+	cases := []zipEntry{
+		{name: "src/link.md", data: []byte("/etc/passwd"), mode: fs.ModeSymlink | 0o777},
+		{name: "dev", mode: fs.ModeDevice | 0o600},
+		{name: "fifo", mode: fs.ModeNamedPipe | 0o600},
+	}
+	for _, e := range cases {
+		dir := t.TempDir()
+		err := ExtractZip(writeZip(t, e), dir, testLimits)
+		if !errors.Is(err, ErrUnsupportedEntry) {
+			t.Errorf("%s: got %v, want ErrUnsupportedEntry", e.name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, e.name)); err == nil {
+			t.Errorf("%s: entry was written", e.name)
+		}
+	}
+
+	if err := ExtractZip(writeZip(t, zipEntry{name: "../escape.md", data: []byte("x")}), t.TempDir(), testLimits); err == nil {
+		t.Error("expected path traversal to be rejected")
+	}
+}
@@ -0,0 +1,184 @@
+package sessions
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Store persists login sessions. Each session holds one rotating refresh
+// token; access tokens name their session and stop working as soon as it
+// is revoked.
+type Store struct {
+	cfg    config.Config
+	client *mongo.Client
+}
+
+func NewStore(cfg config.Config, client *mongo.Client) *Store {
+	return &Store{cfg: cfg, client: client}
+}
+
+func (s *Store) sessions() *mongo.Collection {
+	return s.client.Database(s.cfg.MongoDB).Collection("sessions")
+}
+
+// Create starts a session for userID and returns it with its first
+// refresh token.
+func (s *Store) Create(userID primitive.ObjectID, userAgent, ip string) (models.Session, string, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	secret, err := auth.RandomToken(32)
+	if err != nil {
+		return models.Session{}, "", err
+	}
+	now := time.Now()
+	session := models.Session{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		RefreshHash: auth.HashToken(secret),
+		UserAgent:   userAgent,
+		IP:          ip,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(s.cfg.RefreshTTL),
+	}
+	if _, err := s.sessions().InsertOne(ctx, session); err != nil {
+		return models.Session{}, "", err
+	}
+	return session, refreshToken(session.ID, secret), nil
+}
+
+// Rotate exchanges a refresh token for a new one. Presenting a refresh
+// token that was already rotated away means it has leaked, so the whole
+// session is revoked.
+func (s *Store) Rotate(token string) (models.Session, string, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	id, secret, ok := splitRefreshToken(token)
+	if !ok {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	var session models.Session
+	if err := s.sessions().FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	hash := auth.HashToken(secret)
+	if session.PrevRefreshHash != "" && equal(hash, session.PrevRefreshHash) {
+		_ = s.Revoke(session.ID)
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	if !equal(hash, session.RefreshHash) {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+
+	next, err := auth.RandomToken(32)
+	if err != nil {
+		return models.Session{}, "", err
+	}
+	nextHash := auth.HashToken(next)
+	res, err := s.sessions().UpdateOne(ctx,
+		bson.M{"_id": session.ID, "refresh_hash": session.RefreshHash, "revoked_at": nil},
+		bson.M{"$set": bson.M{"refresh_hash": nextHash, "prev_refresh_hash": session.RefreshHash, "last_used_at": time.Now()}},
+	)
+	if err != nil {
+		return models.Session{}, "", err
+	}
+	if res.ModifiedCount == 0 {
+		// Lost a race with another refresh of the same token.
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	session.RefreshHash = nextHash
+	return session, refreshToken(session.ID, next), nil
+}
+
+// Lookup returns the live session a refresh token belongs to without
+// rotating it.
+func (s *Store) Lookup(token string) (models.Session, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	id, secret, ok := splitRefreshToken(token)
+	if !ok {
+		return models.Session{}, ErrInvalidRefreshToken
+	}
+	var session models.Session
+	if err := s.sessions().FindOne(ctx, bson.M{"_id": id, "revoked_at": nil}).Decode(&session); err != nil {
+		return models.Session{}, ErrInvalidRefreshToken
+	}
+	if !equal(auth.HashToken(secret), session.RefreshHash) {
+		return models.Session{}, ErrInvalidRefreshToken
+	}
+	return session, nil
+}
+
+// Active reports whether the session an access token names may still be
+// used.
+func (s *Store) Active(sessionID string) bool {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false
+	}
+	count, err := s.sessions().CountDocuments(ctx, bson.M{
+		"_id":        id,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	return err == nil && count > 0
+}
+
+func (s *Store) Revoke(sessionID primitive.ObjectID) error {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	_, err := s.sessions().UpdateOne(ctx,
+		bson.M{"_id": sessionID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeUser ends every session of a user, e.g. after they are
+// deactivated or their role changes.
+func (s *Store) RevokeUser(userID primitive.ObjectID) error {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	_, err := s.sessions().UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+func refreshToken(id primitive.ObjectID, secret string) string {
+	return id.Hex() + "." + secret
+}
+
+func splitRefreshToken(token string) (primitive.ObjectID, string, bool) {
+	idHex, secret, found := strings.Cut(token, ".")
+	if !found || secret == "" {
+		return primitive.ObjectID{}, "", false
+	}
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return primitive.ObjectID{}, "", false
+	}
+	return id, secret, true
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,53 @@
+package settings
+
+import (
+	"errors"
+
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const settingsID = "settings"
+
+// Store reads and updates the server-wide settings document. A missing
+// document means every setting is at its default.
+type Store struct {
+	cfg    config.Config
+	client *mongo.Client
+}
+
+func NewStore(cfg config.Config, client *mongo.Client) *Store {
+	return &Store{cfg: cfg, client: client}
+}
+
+func (s *Store) settings() *mongo.Collection {
+	return s.client.Database(s.cfg.MongoDB).Collection("settings")
+}
+
+func (s *Store) Get() (models.Settings, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	var current models.Settings
+	err := s.settings().FindOne(ctx, bson.M{"_id": settingsID}).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Settings{ID: settingsID}, nil
+	}
+	return current, err
+}
+
+// Update applies the given fields and returns the resulting settings.
+func (s *Store) Update(fields bson.M) (models.Settings, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	var updated models.Settings
+	err := s.settings().FindOneAndUpdate(ctx,
+		bson.M{"_id": settingsID},
+		bson.M{"$set": fields},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&updated)
+	return updated, err
+}
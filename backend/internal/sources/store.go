@@ -0,0 +1,277 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-mdbook/internal/config"
+	"go-mdbook/internal/gitsource"
+	"go-mdbook/internal/models"
+	"go-mdbook/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrNoGitSource      = errors.New("book has no git source")
+)
+
+// Store keeps every source upload of a book as an immutable, numbered
+// revision archive and controls which revision is extracted into the
+// book's SourceDir. Changes to a book's SourceDir and its active revision
+// are serialized per book, and Snapshot reads both under the same lock.
+type Store struct {
+	cfg    config.Config
+	client *mongo.Client
+	git    *gitsource.Fetcher
+
+	mu    sync.Mutex
+	locks map[primitive.ObjectID]*sync.Mutex
+}
+
+func NewStore(cfg config.Config, client *mongo.Client) *Store {
+	return &Store{cfg: cfg, client: client, git: gitsource.NewFetcher(cfg), locks: map[primitive.ObjectID]*sync.Mutex{}}
+}
+
+func (s *Store) lock(bookID primitive.ObjectID) func() {
+	s.mu.Lock()
+	l, ok := s.locks[bookID]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[bookID] = l
+	}
+	s.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func (s *Store) revisions() *mongo.Collection {
+	return s.client.Database(s.cfg.MongoDB).Collection("revisions")
+}
+
+func (s *Store) books() *mongo.Collection {
+	return s.client.Database(s.cfg.MongoDB).Collection("books")
+}
+
+// ArchiveError reports an uploaded archive that could not be unpacked.
+type ArchiveError struct {
+	Err error
+}
+
+func (e *ArchiveError) Error() string { return "invalid archive: " + e.Err.Error() }
+
+func (e *ArchiveError) Unwrap() error { return e.Err }
+
+// Upload records the zip at archivePath as the book's next revision and
+// makes it the active source. The archive is unpacked and checked to be an
+// mdBook project (a *services.ProjectError if not) before anything is
+// stored, so a broken upload leaves the book untouched.
+func (s *Store) Upload(book models.Book, archivePath, filename string, userID primitive.ObjectID) (models.Revision, error) {
+	return s.importArchive(book, archivePath, models.Revision{Filename: filename, UploadedBy: userID})
+}
+
+// Sync exports the book's Git source at its configured ref and imports it
+// like an upload, unless that commit is already the active source; changed
+// reports which. The book records the synced commit either way.
+func (s *Store) Sync(ctx context.Context, book models.Book, userID primitive.ObjectID) (rev models.Revision, changed bool, err error) {
+	if book.Git == nil {
+		return models.Revision{}, false, ErrNoGitSource
+	}
+	tmp, err := os.MkdirTemp("", "mdbook-sync-")
+	if err != nil {
+		return models.Revision{}, false, err
+	}
+	defer os.RemoveAll(tmp)
+	archive := filepath.Join(tmp, "source.zip")
+	sha, err := s.git.Export(ctx, book.ID.Hex(), *book.Git, archive)
+	if err != nil {
+		return models.Revision{}, false, err
+	}
+
+	if sha == book.GitSHA && book.ActiveRevision != 0 {
+		if active, err := s.Get(book.ID, book.ActiveRevision); err == nil && active.Commit == sha {
+			return active, false, s.markSynced(book.ID, sha)
+		}
+	}
+	rev, err = s.importArchive(book, archive, models.Revision{Filename: "git-" + sha[:12] + ".zip", UploadedBy: userID, Commit: sha})
+	if err != nil {
+		return models.Revision{}, false, err
+	}
+	return rev, true, s.markSynced(book.ID, sha)
+}
+
+func (s *Store) markSynced(bookID primitive.ObjectID, sha string) error {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	_, err := s.books().UpdateByID(ctx, bookID, bson.M{"$set": bson.M{"git_sha": sha, "synced_at": time.Now()}})
+	return err
+}
+
+// importArchive stores archivePath as the book's next revision, described
+// by meta, and makes it the active source. Numbering and activation happen
+// under the book's lock, so concurrent imports activate in revision order.
+func (s *Store) importArchive(book models.Book, archivePath string, meta models.Revision) (models.Revision, error) {
+	staged, err := s.stage(book, archivePath)
+	if err != nil {
+		return models.Revision{}, err
+	}
+	unlock := s.lock(book.ID)
+	defer unlock()
+	rev, err := s.create(book, archivePath, meta)
+	if err != nil {
+		_ = os.RemoveAll(staged)
+		return models.Revision{}, err
+	}
+	return rev, s.swap(book, rev, staged)
+}
+
+// Activate replaces the book's SourceDir with the contents of rev. The
+// current source stays in place until the new one is fully extracted.
+func (s *Store) Activate(book models.Book, rev models.Revision) error {
+	staged, err := s.stage(book, rev.ArchivePath)
+	if err != nil {
+		return err
+	}
+	unlock := s.lock(book.ID)
+	defer unlock()
+	return s.swap(book, rev, staged)
+}
+
+// Snapshot copies the book's SourceDir into dir and returns the revision
+// that was active at the time, 0 if the book has none. Imports and
+// activations wait until the copy is complete.
+func (s *Store) Snapshot(book models.Book, dir string) (int, error) {
+	unlock := s.lock(book.ID)
+	defer unlock()
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	var current models.Book
+	opts := options.FindOne().SetProjection(bson.M{"active_revision": 1})
+	if err := s.books().FindOne(ctx, bson.M{"_id": book.ID}, opts).Decode(&current); err != nil {
+		return 0, err
+	}
+	if err := services.CopyDir(book.SourceDir, dir); err != nil {
+		return 0, err
+	}
+	return current.ActiveRevision, nil
+}
+
+// Checkout extracts rev into dir.
+func (s *Store) Checkout(rev models.Revision, dir string) error {
+	if err := services.ExtractZip(rev.ArchivePath, dir, s.zipLimits()); err != nil {
+		return err
+	}
+	return services.PrepareProject(dir)
+}
+
+func (s *Store) zipLimits() services.ZipLimits {
+	return services.ZipLimits{
+		MaxEntries:   s.cfg.ZipMaxEntries,
+		MaxFileSize:  s.cfg.ZipMaxFileSize,
+		MaxTotalSize: s.cfg.ZipMaxTotalSize,
+		MaxRatio:     s.cfg.ZipMaxRatio,
+	}
+}
+
+func (s *Store) stage(book models.Book, archivePath string) (string, error) {
+	if book.SourceDir == "" {
+		return "", errors.New("missing source directory")
+	}
+	staged, err := services.StagingDir(book.SourceDir)
+	if err != nil {
+		return "", err
+	}
+	if err := services.ExtractZip(archivePath, staged, s.zipLimits()); err != nil {
+		_ = os.RemoveAll(staged)
+		return "", &ArchiveError{Err: err}
+	}
+	if err := services.PrepareProject(staged); err != nil {
+		_ = os.RemoveAll(staged)
+		return "", err
+	}
+	return staged, nil
+}
+
+func (s *Store) swap(book models.Book, rev models.Revision, staged string) error {
+	if err := services.ReplaceDir(book.SourceDir, staged); err != nil {
+		_ = os.RemoveAll(staged)
+		return err
+	}
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	_, err := s.books().UpdateByID(ctx, book.ID, bson.M{"$set": bson.M{"active_revision": rev.Number}})
+	return err
+}
+
+func (s *Store) create(book models.Book, archivePath string, meta models.Revision) (models.Revision, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	var numbered models.Book
+	err := s.books().FindOneAndUpdate(ctx,
+		bson.M{"_id": book.ID},
+		bson.M{"$inc": bson.M{"revision_seq": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&numbered)
+	if err != nil {
+		return models.Revision{}, err
+	}
+
+	number := numbered.RevisionSeq
+	dest := filepath.Join(s.cfg.RevisionsRoot, book.ID.Hex(), strconv.Itoa(number)+".zip")
+	checksum, size, err := services.CopyFile(archivePath, dest)
+	if err != nil {
+		return models.Revision{}, fmt.Errorf("store revision archive: %w", err)
+	}
+
+	rev := meta
+	rev.BookID = book.ID
+	rev.Number = number
+	rev.CreatedAt = time.Now()
+	rev.Checksum = checksum
+	rev.Size = size
+	rev.ArchivePath = dest
+	res, err := s.revisions().InsertOne(ctx, rev)
+	if err != nil {
+		_ = os.Remove(dest)
+		return models.Revision{}, err
+	}
+	rev.ID = res.InsertedID.(primitive.ObjectID)
+	return rev, nil
+}
+
+func (s *Store) Get(bookID primitive.ObjectID, number int) (models.Revision, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	var rev models.Revision
+	err := s.revisions().FindOne(ctx, bson.M{"book_id": bookID, "number": number}).Decode(&rev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Revision{}, ErrRevisionNotFound
+	}
+	return rev, err
+}
+
+func (s *Store) List(bookID primitive.ObjectID) ([]models.Revision, error) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "number", Value: -1}})
+	cur, err := s.revisions().Find(ctx, bson.M{"book_id": bookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	list := []models.Revision{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,195 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go-mdbook/internal/access"
+	"go-mdbook/internal/auth"
+	"go-mdbook/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNotConfigured = errors.New("single sign-on is not configured")
+	ErrNonceMismatch = errors.New("id token nonce does not match")
+)
+
+// Identity is what the identity provider asserts about a user.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Groups        []string
+}
+
+// Request carries the per-login secrets through the browser round-trip:
+// state binds the callback to the browser that started the login, nonce
+// binds the ID token to it and verifier is the PKCE code verifier.
+type Request struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func NewRequest() (Request, error) {
+	var r Request
+	for _, field := range []*string{&r.State, &r.Nonce} {
+		token, err := auth.RandomToken(24)
+		if err != nil {
+			return Request{}, err
+		}
+		*field = token
+	}
+	r.Verifier = oauth2.GenerateVerifier()
+	return r, nil
+}
+
+// Encode packs the request into a cookie value. The parts are URL-safe
+// base64, so "." never occurs inside them.
+func (r Request) Encode() string {
+	return r.State + "." + r.Nonce + "." + r.Verifier
+}
+
+func ParseRequest(value string) (Request, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return Request{}, false
+	}
+	return Request{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, true
+}
+
+// Provider signs users in through an OpenID Connect identity provider.
+// The issuer is discovered on first use, so the server starts even while
+// the identity provider is unreachable.
+type Provider struct {
+	cfg config.Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func New(cfg config.Config) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+func (p *Provider) Enabled() bool {
+	return p.cfg.OIDCIssuer != "" && p.cfg.OIDCClientID != ""
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, error) {
+	if !p.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, p.cfg.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover issuer: %w", err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *Provider) oauth2Config(provider *oidc.Provider) oauth2.Config {
+	return oauth2.Config{
+		ClientID:     p.cfg.OIDCClientID,
+		ClientSecret: p.cfg.OIDCClientSecret,
+		RedirectURL:  p.cfg.OIDCRedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.OIDCScopes,
+	}
+}
+
+// AuthURL is where the browser is sent to sign in.
+func (p *Provider) AuthURL(ctx context.Context, req Request) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	conf := p.oauth2Config(provider)
+	return conf.AuthCodeURL(req.State, oidc.Nonce(req.Nonce), oauth2.S256ChallengeOption(req.Verifier)), nil
+}
+
+// Exchange redeems the authorization code from the callback and verifies
+// the ID token that comes with it.
+func (p *Provider) Exchange(ctx context.Context, req Request, code string) (Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	conf := p.oauth2Config(provider)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("exchange code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.OIDCClientID}).Verify(ctx, raw)
+	if err != nil {
+		return Identity{}, fmt.Errorf("verify id token: %w", err)
+	}
+	if idToken.Nonce != req.Nonce {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+	identity := Identity{
+		Subject:       idToken.Subject,
+		EmailVerified: p.cfg.OIDCAssumeVerified,
+		Groups:        stringList(claims[p.cfg.OIDCGroupsClaim]),
+	}
+	identity.Email, _ = claims["email"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok {
+		identity.EmailVerified = verified
+	}
+	return identity, nil
+}
+
+// Role maps the groups an identity belongs to onto the most privileged
+// role configured for any of them.
+func (p *Provider) Role(groups []string) string {
+	roles := []string{}
+	for _, g := range groups {
+		if role, ok := p.cfg.OIDCRoleMapping[g]; ok {
+			roles = append(roles, role)
+		}
+	}
+	if role := access.HighestRole(roles...); role != "" {
+		return role
+	}
+	if access.ValidRole(p.cfg.OIDCDefaultRole) {
+		return p.cfg.OIDCDefaultRole
+	}
+	return access.RoleReader
+}
+
+// stringList accepts a claim holding either a list or a single string.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-mdbook/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier against the challenge it saw.
+type mockIssuer struct {
+	t         *testing.T
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		writeJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockIssuer) config() config.Config {
+	return config.Config{
+		OIDCIssuer:      m.server.URL,
+		OIDCClientID:    "mdbook",
+		OIDCRedirectURL: "http://localhost/callback",
+		OIDCScopes:      []string{"openid", "email"},
+		OIDCGroupsClaim: "groups",
+		OIDCRoleMapping: map[string]string{"writers": "editor", "ops": "admin"},
+		OIDCDefaultRole: "reader",
+	}
+}
+
+// login runs the browser part of the flow: it fetches the authorization URL
+// and remembers the PKCE challenge the way the identity provider would.
+func (m *mockIssuer) login(p *Provider) Request {
+	req, err := NewRequest()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	target, err := p.AuthURL(context.Background(), req)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != req.State || q.Get("nonce") != req.Nonce || q.Get("code_challenge_method") != "S256" {
+		m.t.Fatalf("unexpected authorization URL %s", target)
+	}
+	m.challenge = q.Get("code_challenge")
+	return req
+}
+
+func (m *mockIssuer) idClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "mdbook",
+		"sub":            "user-1",
+		"email":          "Ada@example.com",
+		"email_verified": true,
+		"groups":         []string{"staff", "writers"},
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	p := New(m.config())
+	req := m.login(p)
+	m.claims = m.idClaims(req.Nonce)
+
+	identity, err := p.Exchange(context.Background(), req, "good-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "user-1" || identity.Email != "Ada@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if role := p.Role(identity.Groups); role != "editor" {
+		t.Fatalf("expected editor, got %q", role)
+	}
+}
+
+func TestExchangeEmailVerified(t *testing.T) {
+	m := newMockIssuer(t)
+	for _, assume := range []bool{false, true} {
+		cfg := m.config()
+		cfg.OIDCAssumeVerified = assume
+		p := New(cfg)
+		req := m.login(p)
+		m.claims = m.idClaims(req.Nonce)
+		delete(m.claims, "email_verified")
+
+		identity, err := p.Exchange(context.Background(), req, "good-code")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.EmailVerified != assume {
+			t.Errorf("assume %v: got EmailVerified %v without the claim", assume, identity.EmailVerified)
+		}
+	}
+}
+
+func TestExchangeRejectsBadTokens(t *testing.T) {
+	m := newMockIssuer(t)
+	p := New(m.config())
+
+	cases := map[string]func(req Request) (Request, jwt.MapClaims){
+		"nonce": func(req Request) (Request, jwt.MapClaims) {
+			return req, m.idClaims("other")
+		},
+		"audience": func(req Request) (Request, jwt.MapClaims) {
+			claims := m.idClaims(req.Nonce)
+			claims["aud"] = "someone-else"
+			return req, claims
+		},
+		"expired": func(req Request) (Request, jwt.MapClaims) {
+			claims := m.idClaims(req.Nonce)
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return req, claims
+		},
+		"verifier": func(req Request) (Request, jwt.MapClaims) {
+			claims := m.idClaims(req.Nonce)
+			req.Verifier = "wrong-verifier-wrong-verifier-wrong-verifier"
+			return req, claims
+		},
+	}
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, claims := tamper(m.login(p))
+			m.claims = claims
+			if _, err := p.Exchange(context.Background(), req, "good-code"); err == nil {
+				t.Fatal("expected exchange to fail")
+			}
+		})
+	}
+}
+
+func TestRole(t *testing.T) {
+	p := New(config.Config{
+		OIDCRoleMapping: map[string]string{"writers": "editor", "ops": "admin"},
+		OIDCDefaultRole: "reader",
+	})
+	cases := []struct {
+		groups []string
+		want   string
+	}{
+		{nil, "reader"},
+		{[]string{"staff"}, "reader"},
+		{[]string{"writers"}, "editor"},
+		{[]string{"writers", "ops"}, "admin"},
+	}
+	for _, tc := range cases {
+		if got := p.Role(tc.groups); got != tc.want {
+			t.Errorf("Role(%v) = %q, want %q", tc.groups, got, tc.want)
+		}
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	req, err := NewRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := ParseRequest(req.Encode())
+	if !ok || parsed != req {
+		t.Fatalf("round trip lost data: %+v vs %+v", parsed, req)
+	}
+	if _, ok := ParseRequest("a.b"); ok {
+		t.Fatal("expected malformed value to be rejected")
+	}
+}
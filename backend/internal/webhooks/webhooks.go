@@ -0,0 +1,141 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitea  = "gitea"
+	ProviderGitLab = "gitlab"
+)
+
+var (
+	ErrUnknownSender = errors.New("unrecognized webhook sender")
+	ErrSignature     = errors.New("invalid webhook signature")
+	ErrNotPush       = errors.New("not a push event")
+	ErrPayload       = errors.New("malformed push payload")
+)
+
+// Push is a branch or tag update reported by a Git host.
+type Push struct {
+	Provider string
+	Event    string
+	Ref      string
+	After    string
+
+	// DefaultBranch is the repository's default branch when the payload
+	// names it.
+	DefaultBranch string
+}
+
+type payload struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	Project struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+// Parse authenticates a webhook delivery with the shared secret and decodes
+// it as a push. GitHub and Gitea sign the body with HMAC-SHA256; GitLab
+// sends the secret itself. The signature is checked before anything else
+// is read from the body. Deliveries of other events return ErrNotPush.
+func Parse(header http.Header, body []byte, secret string) (Push, error) {
+	if secret == "" {
+		return Push{}, ErrSignature
+	}
+	var p Push
+	// Gitea and Forgejo also send X-GitHub-Event, so they are matched first.
+	switch {
+	case header.Get("X-Gitea-Event") != "" || header.Get("X-Forgejo-Event") != "":
+		p.Provider = ProviderGitea
+		p.Event = firstHeader(header, "X-Gitea-Event", "X-Forgejo-Event")
+		if !validHMAC(body, secret, firstHeader(header, "X-Gitea-Signature", "X-Forgejo-Signature")) {
+			return Push{}, ErrSignature
+		}
+	case header.Get("X-Gitlab-Event") != "":
+		p.Provider = ProviderGitLab
+		p.Event = header.Get("X-Gitlab-Event")
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return Push{}, ErrSignature
+		}
+	case header.Get("X-GitHub-Event") != "":
+		p.Provider = ProviderGitHub
+		p.Event = header.Get("X-GitHub-Event")
+		sig, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok || !validHMAC(body, secret, sig) {
+			return Push{}, ErrSignature
+		}
+	default:
+		return Push{}, ErrUnknownSender
+	}
+
+	switch p.Event {
+	case "push", "Push Hook", "Tag Push Hook":
+	default:
+		return p, fmt.Errorf("%w: %s", ErrNotPush, p.Event)
+	}
+	var pl payload
+	if err := json.Unmarshal(body, &pl); err != nil {
+		return p, fmt.Errorf("%w: %v", ErrPayload, err)
+	}
+	if !strings.HasPrefix(pl.Ref, "refs/") {
+		return p, fmt.Errorf("%w: missing ref", ErrPayload)
+	}
+	p.Ref = pl.Ref
+	p.After = pl.After
+	p.DefaultBranch = pl.Repository.DefaultBranch
+	if p.DefaultBranch == "" {
+		p.DefaultBranch = pl.Project.DefaultBranch
+	}
+	return p, nil
+}
+
+// Deleted reports whether the push removed the ref.
+func (p Push) Deleted() bool {
+	return p.After != "" && strings.Trim(p.After, "0") == ""
+}
+
+// Matches reports whether the push updated ref as configured on a book: a
+// full ref name, a branch or tag name, or "" for the default branch.
+func (p Push) Matches(ref string) bool {
+	switch {
+	case ref == "":
+		return p.DefaultBranch != "" && p.Ref == "refs/heads/"+p.DefaultBranch
+	case strings.HasPrefix(ref, "refs/"):
+		return p.Ref == ref
+	default:
+		return p.Ref == "refs/heads/"+ref || p.Ref == "refs/tags/"+ref
+	}
+}
+
+func validHMAC(body []byte, secret, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) != sha256.Size {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func firstHeader(header http.Header, names ...string) string {
+	for _, name := range names {
+		if v := header.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// secret is the one used to record the deliveries in testdata.
+const secret = "It's a Secret to Everybody"
+
+func delivery(t *testing.T, name string, headers map[string]string) (http.Header, []byte) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return h, body
+}
+
+func TestParseRecordedPushes(t *testing.T) {
+	cases := []struct {
+		file    string
+		headers map[string]string
+		want    Push
+	}{
+		{
+			file: "github_push.json",
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-GitHub-Delivery":   "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+				"X-Hub-Signature-256": "sha256=8b144ae9d737b3fc9d91411fcffe18aa940c418e0e88efda7b2dedcf96ace6b3",
+			},
+			want: Push{Provider: ProviderGitHub, Event: "push", Ref: "refs/heads/main", After: "c441029cf673f84c8b7db52d0a5944ee5c52ff89", DefaultBranch: "main"},
+		},
+		{
+			file: "gitea_push.json",
+			headers: map[string]string{
+				"X-GitHub-Event":    "push",
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Delivery":  "f6266f16-1bf3-46a5-9ea4-602e06ead473",
+				"X-Gitea-Signature": "a9b183e8dc453dd2b06d6a0ebc2f6759b2407413ce77fad71adb44551a8a514c",
+			},
+			want: Push{Provider: ProviderGitea, Event: "push", Ref: "refs/heads/release/1.x", After: "9e2ab8b5c0f1dfd6a1c3b0e6f7d8c9a0b1c2d3e4", DefaultBranch: "main"},
+		},
+		{
+			file: "gitlab_push.json",
+			headers: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": secret,
+			},
+			want: Push{Provider: ProviderGitLab, Event: "Push Hook", Ref: "refs/heads/main", After: "da1560886d4f094c3e6c9ef40349f7d38b5d27d7", DefaultBranch: "main"},
+		},
+	}
+	for _, tc := range cases {
+		header, body := delivery(t, tc.file, tc.headers)
+		got, err := Parse(header, body, secret)
+		if err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.file, got, tc.want)
+		}
+		if got.Deleted() {
+			t.Errorf("%s: reported as deleted", tc.file)
+		}
+	}
+}
+
+func TestParseRejectsBadSignatures(t *testing.T) {
+	cases := []struct {
+		file    string
+		headers map[string]string
+	}{
+		{"github_push.json", map[string]string{"X-GitHub-Event": "push"}},
+		{"github_push.json", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature": "sha1=0123"}},
+		{"github_push.json", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=a9b183e8dc453dd2b06d6a0ebc2f6759b2407413ce77fad71adb44551a8a514c"}},
+		{"gitea_push.json", map[string]string{"X-Gitea-Event": "push", "X-Hub-Signature-256": "sha256=a9b183e8dc453dd2b06d6a0ebc2f6759b2407413ce77fad71adb44551a8a514c"}},
+		{"gitlab_push.json", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "guess"}},
+	}
+	for _, tc := range cases {
+		header, body := delivery(t, tc.file, tc.headers)
+		if _, err := Parse(header, body, secret); !errors.Is(err, ErrSignature) {
+			t.Errorf("%s %v: got %v, want ErrSignature", tc.file, tc.headers, err)
+		}
+	}
+
+	// A correctly signed body that was altered in transit.
+	header, body := delivery(t, "github_push.json", map[string]string{
+		"X-GitHub-Event":      "push",
+		"X-Hub-Signature-256": "sha256=8b144ae9d737b3fc9d91411fcffe18aa940c418e0e88efda7b2dedcf96ace6b3",
+	})
+	body[10] ^= 1
+	if _, err := Parse(header, body, secret); !errors.Is(err, ErrSignature) {
+		t.Errorf("tampered body: %v", err)
+	}
+	if _, err := Parse(header, body, ""); !errors.Is(err, ErrSignature) {
+		t.Errorf("empty secret: %v", err)
+	}
+	if _, err := Parse(http.Header{}, body, secret); !errors.Is(err, ErrUnknownSender) {
+		t.Errorf("no event header: %v", err)
+	}
+}
+
+func TestParseOtherEvents(t *testing.T) {
+	header, body := delivery(t, "github_ping.json", map[string]string{
+		"X-GitHub-Event":      "ping",
+		"X-Hub-Signature-256": "sha256=840aa9121ef012b8f9559a7a87dfe3e0af592e9e17de58cecd4c33e757748812",
+	})
+	if _, err := Parse(header, body, secret); !errors.Is(err, ErrNotPush) {
+		t.Errorf("ping: %v", err)
+	}
+
+	header, body = delivery(t, "gitlab_delete.json", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": secret})
+	p, err := Parse(header, body, secret)
+	if err != nil || !p.Deleted() {
+		t.Errorf("branch deletion: %+v, %v", p, err)
+	}
+}
+
+func TestPushMatches(t *testing.T) {
+	branch := Push{Ref: "refs/heads/main", DefaultBranch: "main"}
+	tag := Push{Ref: "refs/tags/v1.0", DefaultBranch: "main"}
+	cases := []struct {
+		push Push
+		ref  string
+		want bool
+	}{
+		{branch, "", true},
+		{branch, "main", true},
+		{branch, "refs/heads/main", true},
+		{branch, "develop", false},
+		{branch, "refs/tags/main", false},
+		{branch, "c441029cf673f84c8b7db52d0a5944ee5c52ff89", false},
+		{Push{Ref: "refs/heads/main"}, "", false},
+		{tag, "v1.0", true},
+		{tag, "", false},
+		{Push{Ref: "refs/heads/release/1.x"}, "release/1.x", true},
+	}
+	for _, tc := range cases {
+		if got := tc.push.Matches(tc.ref); got != tc.want {
+			t.Errorf("%s matches %q = %v, want %v", tc.push.Ref, tc.ref, got, tc.want)
+		}
+	}
+}
@@ -1,26 +1,65 @@
 import { useEffect, useMemo, useState } from 'react'
-import { api, bookContentUrl, clearAuth, getEmail, getRole, setAuth } from './api/client'
+import {
+  api,
+  bookContentUrl,
+  clearAuth,
+  consumeInviteToken,
+  consumeSsoRedirect,
+  getEmail,
+  getRole,
+  setAuth,
+  ssoLoginUrl
+} from './api/client'
 
 function App() {
   const [auth, setAuthState] = useState({ token: localStorage.getItem('token') || '' })
   const [books, setBooks] = useState([])
   const [users, setUsers] = useState([])
   const [selectedBook, setSelectedBook] = useState(null)
+  const [contentSrc, setContentSrc] = useState('')
   const [error, setError] = useState('')
   const [loading, setLoading] = useState(false)
   const [activeModule, setActiveModule] = useState('books')
   const [booksView, setBooksView] = useState('list')
   const [usersView, setUsersView] = useState('list')
+  const [mfaToken, setMfaToken] = useState('')
+  const [inviteToken, setInviteToken] = useState(() => consumeInviteToken())
+  const [invites, setInvites] = useState([])
+  const [inviteLink, setInviteLink] = useState(null)
 
   const role = useMemo(() => getRole(), [auth])
   const email = useMemo(() => getEmail(), [auth])
 
+  useEffect(() => {
+    const result = consumeSsoRedirect()
+    if (result?.error) setError(result.error)
+    else if (result?.mfaToken) setMfaToken(result.mfaToken)
+    else if (result?.token) setAuthState({ token: result.token })
+  }, [])
+
   useEffect(() => {
     if (!auth.token) return
     refreshBooks()
-    if (role === 'admin') refreshUsers()
+    if (role === 'admin') {
+      refreshUsers()
+      refreshInvites()
+    }
   }, [auth.token, role])
 
+  useEffect(() => {
+    setContentSrc('')
+    if (!selectedBook) return
+    let cancelled = false
+    bookContentUrl(selectedBook.id)
+      .then((url) => {
+        if (!cancelled) setContentSrc(url)
+      })
+      .catch((err) => setError(err.message))
+    return () => {
+      cancelled = true
+    }
+  }, [selectedBook])
+
   async function refreshBooks() {
     setLoading(true)
     try {
@@ -42,11 +81,22 @@ function App() {
     }
   }
 
+  async function refreshInvites() {
+    try {
+      const data = await api.listInvites()
+      setInvites(data)
+    } catch (err) {
+      setError(err.message)
+    }
+  }
+
   function handleLogout() {
+    api.logout().catch(() => {})
     clearAuth()
     setAuthState({ token: '' })
     setBooks([])
     setUsers([])
+    setInvites([])
     setSelectedBook(null)
   }
 
@@ -57,26 +107,73 @@ function App() {
     const payload = { email: form.get('email'), password: form.get('password') }
     try {
       const data = await api.login(payload)
-      setAuth(data.token, data.role, data.email)
+      if (data.mfaRequired) {
+        setMfaToken(data.mfaToken)
+        return
+      }
+      setAuth(data.token, data.role, data.email, data.refreshToken)
+      setAuthState({ token: data.token })
+    } catch (err) {
+      setError(err.message)
+    }
+  }
+
+  async function handleTwoFactor(e) {
+    e.preventDefault()
+    setError('')
+    const form = new FormData(e.currentTarget)
+    try {
+      const data = await api.completeTwoFactor({ mfaToken, code: form.get('code') })
+      setMfaToken('')
+      setAuth(data.token, data.role, data.email, data.refreshToken)
       setAuthState({ token: data.token })
     } catch (err) {
       setError(err.message)
     }
   }
 
-  async function handleCreateUser(e) {
+  async function handleAcceptInvite(e) {
     e.preventDefault()
     setError('')
     const form = new FormData(e.currentTarget)
+    if (form.get('password') !== form.get('confirm')) {
+      setError('Passwords do not match')
+      return
+    }
+    try {
+      const data = await api.acceptInvite({ token: inviteToken, password: form.get('password') })
+      setInviteToken('')
+      setAuth(data.token, data.role, data.email, data.refreshToken)
+      setAuthState({ token: data.token })
+    } catch (err) {
+      setError(err.message)
+    }
+  }
+
+  async function handleCreateInvite(e) {
+    e.preventDefault()
+    setError('')
+    const formEl = e.currentTarget
+    const form = new FormData(formEl)
     const payload = {
       email: form.get('email'),
-      password: form.get('password'),
       role: form.get('role')
     }
     try {
-      await api.createUser(payload)
-      e.currentTarget.reset()
-      refreshUsers()
+      const data = await api.createInvite(payload)
+      formEl.reset()
+      setInviteLink({ email: data.invite.email, url: data.url, sent: data.sent })
+      refreshInvites()
+    } catch (err) {
+      setError(err.message)
+    }
+  }
+
+  async function handleRevokeInvite(id) {
+    setError('')
+    try {
+      await api.revokeInvite(id)
+      refreshInvites()
     } catch (err) {
       setError(err.message)
     }
@@ -172,18 +269,51 @@ function App() {
         </header>
         <section className="card-grid">
           <div className="card">
-            <h2>Login</h2>
-            <form onSubmit={handleLogin} className="form">
-              <label>
-                Email
-                <input name="email" type="email" required />
-              </label>
-              <label>
-                Password
-                <input name="password" type="password" required />
-              </label>
-              <button type="submit">Sign in</button>
-            </form>
+            <h2>{inviteToken ? 'Accept invitation' : 'Login'}</h2>
+            {inviteToken ? (
+              <form onSubmit={handleAcceptInvite} className="form">
+                <label>
+                  Choose a password
+                  <input name="password" type="password" autoComplete="new-password" minLength={8} required />
+                </label>
+                <label>
+                  Confirm password
+                  <input name="confirm" type="password" autoComplete="new-password" minLength={8} required />
+                </label>
+                <button type="submit">Create account</button>
+                <button type="button" className="ghost" onClick={() => setInviteToken('')}>
+                  I already have an account
+                </button>
+              </form>
+            ) : mfaToken ? (
+              <form onSubmit={handleTwoFactor} className="form">
+                <label>
+                  Authentication code or recovery code
+                  <input name="code" type="text" autoComplete="one-time-code" required autoFocus />
+                </label>
+                <button type="submit">Verify</button>
+                <button type="button" className="ghost" onClick={() => setMfaToken('')}>
+                  Back
+                </button>
+              </form>
+            ) : (
+              <form onSubmit={handleLogin} className="form">
+                <label>
+                  Email or username
+                  <input name="email" type="text" autoComplete="username" required />
+                </label>
+                <label>
+                  Password
+                  <input name="password" type="password" required />
+                </label>
+                <button type="submit">Sign in</button>
+              </form>
+            )}
+            {ssoLoginUrl && !inviteToken && (
+              <button type="button" className="ghost" onClick={() => window.location.assign(ssoLoginUrl)}>
+                Sign in with SSO
+              </button>
+            )}
           </div>
         </section>
         {error && <p className="error">{error}</p>}
@@ -293,7 +423,7 @@ function App() {
                         </div>
                       )}
                     </div>
-                    <iframe title="mdbook" src={bookContentUrl(selectedBook.id)} />
+                    {contentSrc && <iframe title="mdbook" src={contentSrc} />}
                   </>
                 )}
               </main>
@@ -334,36 +464,64 @@ function App() {
                 List Users
               </button>
               <button
-                className={usersView === 'create' ? 'nav-active' : 'ghost'}
-                onClick={() => setUsersView('create')}
+                className={usersView === 'invite' ? 'nav-active' : 'ghost'}
+                onClick={() => setUsersView('invite')}
               >
-                Create User
+                Invite User
               </button>
             </nav>
           </div>
 
-          {usersView === 'create' && (
+          {usersView === 'invite' && (
             <div className="card-grid">
               <div className="card">
-                <h3>Create User</h3>
-                <form onSubmit={handleCreateUser} className="form">
+                <h3>Invite User</h3>
+                <form onSubmit={handleCreateInvite} className="form">
                   <label>
                     Email
                     <input name="email" type="email" required />
                   </label>
-                  <label>
-                    Password
-                    <input name="password" type="password" required />
-                  </label>
                   <label>
                     Role
                     <select name="role" defaultValue="reader">
                       <option value="reader">reader</option>
+                      <option value="editor">editor</option>
                       <option value="admin">admin</option>
                     </select>
                   </label>
-                  <button type="submit">Create</button>
+                  <button type="submit">Send invite</button>
                 </form>
+                {inviteLink && (
+                  <div className="invite-link">
+                    <p className="muted">
+                      {inviteLink.sent
+                        ? `Invitation emailed to ${inviteLink.email}. You can also share this link:`
+                        : `Share this one-time link with ${inviteLink.email}:`}
+                    </p>
+                    <input type="text" readOnly value={inviteLink.url} onFocus={(e) => e.target.select()} />
+                  </div>
+                )}
+              </div>
+              <div className="card">
+                <h3>Pending invites</h3>
+                <div className="users">
+                  {invites.map((invite) => (
+                    <div key={invite.id} className="user-row">
+                      <div>
+                        <strong>{invite.email}</strong>
+                        <p className="muted">
+                          {invite.role} · expires {new Date(invite.expiresAt).toLocaleString()}
+                        </p>
+                      </div>
+                      <div className="user-actions">
+                        <button className="danger" onClick={() => handleRevokeInvite(invite.id)}>
+                          Revoke
+                        </button>
+                      </div>
+                    </div>
+                  ))}
+                  {invites.length === 0 && <p className="muted">No pending invites.</p>}
+                </div>
               </div>
             </div>
           )}
@@ -384,6 +542,7 @@ function App() {
                         onChange={(e) => handleUserRoleChange(user.id, e.target.value)}
                       >
                         <option value="reader">reader</option>
+                        <option value="editor">editor</option>
                         <option value="admin">admin</option>
                       </select>
                       <button
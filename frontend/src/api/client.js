@@ -4,18 +4,84 @@ export function getToken() {
   return localStorage.getItem('token')
 }
 
-export function setAuth(token, role, email) {
+export function getRefreshToken() {
+  return localStorage.getItem('refreshToken')
+}
+
+export function setAuth(token, role, email, refreshToken) {
   localStorage.setItem('token', token)
   localStorage.setItem('role', role)
   localStorage.setItem('email', email)
+  if (refreshToken) localStorage.setItem('refreshToken', refreshToken)
 }
 
 export function clearAuth() {
   localStorage.removeItem('token')
+  localStorage.removeItem('refreshToken')
   localStorage.removeItem('role')
   localStorage.removeItem('email')
 }
 
+export const ssoLoginUrl = import.meta.env.VITE_OIDC_ENABLED ? `${API_URL}/auth/oidc/login` : ''
+
+// Single sign-on returns to the app with the tokens, a second-factor
+// challenge or an error in the URL fragment.
+export function consumeSsoRedirect() {
+  const params = new URLSearchParams(window.location.hash.slice(1))
+  if (!params.has('token') && !params.has('mfaToken') && !params.has('error')) return null
+  window.history.replaceState(null, '', window.location.pathname + window.location.search)
+  if (params.has('error')) return { error: params.get('error') }
+  if (params.has('mfaToken')) return { mfaToken: params.get('mfaToken') }
+  setAuth(params.get('token'), params.get('role'), params.get('email'), params.get('refreshToken'))
+  return { token: params.get('token') }
+}
+
+// Invite links carry their token in the URL fragment.
+export function consumeInviteToken() {
+  const params = new URLSearchParams(window.location.hash.slice(1))
+  if (!params.has('invite')) return ''
+  window.history.replaceState(null, '', window.location.pathname + window.location.search)
+  return params.get('invite')
+}
+
+// Access tokens are short-lived; trade the refresh token for a new pair.
+// Concurrent callers share one refresh so the rotated token is not reused.
+let refreshing = null
+async function refreshAuth() {
+  const refreshToken = getRefreshToken()
+  if (!refreshToken) return false
+  if (!refreshing) {
+    refreshing = fetch(`${API_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken })
+    })
+      .then(async (res) => {
+        if (!res.ok) return false
+        const data = await res.json()
+        setAuth(data.token, data.role, data.email, data.refreshToken)
+        return true
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
+async function authorizedFetch(url, options = {}) {
+  const send = () => {
+    const headers = { ...(options.headers || {}) }
+    const token = getToken()
+    if (token) headers.Authorization = `Bearer ${token}`
+    return fetch(url, { ...options, headers })
+  }
+  const res = await send()
+  if (res.status === 401 && (await refreshAuth())) return send()
+  return res
+}
+
 export function getRole() {
   return localStorage.getItem('role') || ''
 }
@@ -26,9 +92,7 @@ export function getEmail() {
 
 async function request(path, options = {}) {
   const headers = { 'Content-Type': 'application/json', ...(options.headers || {}) }
-  const token = getToken()
-  if (token) headers.Authorization = `Bearer ${token}`
-  const res = await fetch(`${API_URL}${path}`, { ...options, headers })
+  const res = await authorizedFetch(`${API_URL}${path}`, { ...options, headers })
   if (!res.ok) {
     let errMsg = 'Request failed'
     try {
@@ -45,24 +109,29 @@ async function request(path, options = {}) {
 
 export const api = {
   login: (payload) => request('/auth/login', { method: 'POST', body: JSON.stringify(payload) }),
+  acceptInvite: (payload) => request('/auth/accept-invite', { method: 'POST', body: JSON.stringify(payload) }),
+  completeTwoFactor: (payload) => request('/auth/2fa', { method: 'POST', body: JSON.stringify(payload) }),
+  logout: () => request('/auth/logout', { method: 'POST', body: JSON.stringify({ refreshToken: getRefreshToken() }) }),
   me: () => request('/me'),
   listBooks: () => request('/books'),
   getBook: (id) => request(`/books/${id}`),
+  contentUrl: (id) => request(`/books/${id}/content-url`, { method: 'POST', body: JSON.stringify({}) }),
   listUsers: () => request('/admin/users'),
   createUser: (payload) => request('/admin/users', { method: 'POST', body: JSON.stringify(payload) }),
   updateUser: (id, payload) => request(`/admin/users/${id}`, { method: 'PATCH', body: JSON.stringify(payload) }),
   deleteUser: (id) => request(`/admin/users/${id}`, { method: 'DELETE' }),
+  listInvites: () => request('/admin/invites'),
+  createInvite: (payload) => request('/admin/invites', { method: 'POST', body: JSON.stringify(payload) }),
+  revokeInvite: (id) => request(`/admin/invites/${id}`, { method: 'DELETE' }),
   createBook: (payload) => request('/admin/books', { method: 'POST', body: JSON.stringify(payload) }),
   updateBook: (id, payload) => request(`/admin/books/${id}`, { method: 'PATCH', body: JSON.stringify(payload) }),
   deleteBook: (id) => request(`/admin/books/${id}`, { method: 'DELETE' }),
   buildBook: (id) => request(`/admin/books/${id}/build`, { method: 'POST' }),
   uploadBook: async (id, file) => {
-    const token = getToken()
     const form = new FormData()
     form.append('file', file)
-    const res = await fetch(`${API_URL}/admin/books/${id}/upload`, {
+    const res = await authorizedFetch(`${API_URL}/admin/books/${id}/upload`, {
       method: 'POST',
-      headers: token ? { Authorization: `Bearer ${token}` } : {},
       body: form
     })
     if (!res.ok) {
@@ -70,6 +139,9 @@ export const api = {
       try {
         const data = await res.json()
         errMsg = data.error || errMsg
+        if (data.problems) {
+          errMsg += ': ' + data.problems.map((p) => (p.path ? `${p.path}: ${p.message}` : p.message)).join('; ')
+        }
       } catch {
         // ignore
       }
@@ -79,7 +151,9 @@ export const api = {
   }
 }
 
-export function bookContentUrl(id, path = '') {
-  const suffix = path ? `/${path.replace(/^\/+/, '')}` : ''
-  return `${API_URL}/books/${id}/content${suffix}`
+// Content is loaded by an iframe, which cannot send the Authorization
+// header, so it is addressed through a signed URL minted by the API.
+export async function bookContentUrl(id) {
+  const data = await api.contentUrl(id)
+  return `${API_URL}${data.path}`
 }